@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// maxHold caps how long one answer can hold a client back, matching the cap
+// agents are expected to apply to delay_ms
+const maxHold = 30 * time.Second
+
+// holdFor returns how long the server asked the agent to hold the client
+// behind resp: the tarpit delay, or the retry hint of a throttle
+func holdFor(resp *pb.LogResponse) time.Duration {
+	ms := resp.GetDelayMs()
+	if resp.GetDecision() == pb.Decision_DECISION_THROTTLED {
+		ms = max(ms, resp.GetRetryAfterMs())
+	}
+	return min(time.Duration(ms)*time.Millisecond, maxHold)
+}
+
+// Holds tracks simulated clients that a tarpit or throttle answer is holding
+// back. Their requests wait instead of going out on the stream, so the client
+// is slowed and not the agent carrying everyone else.
+type Holds struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// NewHolds returns an empty hold list
+func NewHolds() *Holds {
+	return &Holds{until: make(map[string]time.Time)}
+}
+
+// Hold keeps ip back for d from now, extending any hold already in place
+func (h *Holds) Hold(ip string, d time.Duration, now time.Time) {
+	if d <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if until := now.Add(d); until.After(h.until[ip]) {
+		h.until[ip] = until
+	}
+}
+
+// Remaining returns how long ip is still held, 0 if it isn't
+func (h *Holds) Remaining(ip string, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, ok := h.until[ip]
+	if !ok {
+		return 0
+	}
+	if !now.Before(until) {
+		delete(h.until, ip)
+		return 0
+	}
+	return until.Sub(now)
+}
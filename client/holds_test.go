@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+func TestHoldFor(t *testing.T) {
+	tests := []struct {
+		resp *pb.LogResponse
+		want time.Duration
+	}{
+		{&pb.LogResponse{Decision: pb.Decision_DECISION_ALLOWED}, 0},
+		{&pb.LogResponse{Decision: pb.Decision_DECISION_BLOCKED, Action: "tarpit", DelayMs: 2000}, 2 * time.Second},
+		{&pb.LogResponse{Decision: pb.Decision_DECISION_THROTTLED, RetryAfterMs: 500}, 500 * time.Millisecond},
+		// A rate limit ban's retry hint is for the client, not a hold
+		{&pb.LogResponse{Decision: pb.Decision_DECISION_BLOCKED, RetryAfterMs: 60000}, 0},
+		{&pb.LogResponse{Decision: pb.Decision_DECISION_BLOCKED, DelayMs: 600000}, maxHold},
+	}
+	for _, tt := range tests {
+		if got := holdFor(tt.resp); got != tt.want {
+			t.Errorf("holdFor(%v) = %v, want %v", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestHolds(t *testing.T) {
+	h := NewHolds()
+	now := time.Now()
+
+	h.Hold("10.0.0.1", 2*time.Second, now)
+	h.Hold("10.0.0.1", time.Second, now) // A shorter hold doesn't cut it short
+	if got := h.Remaining("10.0.0.1", now.Add(time.Second)); got != time.Second {
+		t.Errorf("remaining after 1s = %v, want 1s", got)
+	}
+	if got := h.Remaining("10.0.0.2", now); got != 0 {
+		t.Errorf("unheld IP remaining = %v, want 0", got)
+	}
+	if got := h.Remaining("10.0.0.1", now.Add(2*time.Second)); got != 0 {
+		t.Errorf("remaining after the hold = %v, want 0", got)
+	}
+	if len(h.until) != 0 {
+		t.Errorf("expired hold kept: %v", h.until)
+	}
+}
@@ -2,10 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/binary"
-	"encoding/hex"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -17,6 +14,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/shashank/intrusiondetection/core"
 	pb "github.com/shashank/intrusiondetection/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -35,19 +33,14 @@ type Stats struct {
 	allowed     atomic.Int64
 	blockedSig  atomic.Int64
 	blockedRate atomic.Int64
+	blockedMore atomic.Int64 // Stopped for any other reason
+	held        atomic.Int64 // Requests kept back by a tarpit or throttle answer
 	errors      atomic.Int64
 }
 
 // generateSignature creates valid HMAC-SHA256
 func generateSignature(payload []byte, timestamp int64) string {
-	mac := hmac.New(sha256.New, []byte(hmacSecretKey))
-	mac.Write(payload)
-
-	tsBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(tsBytes, uint64(timestamp))
-	mac.Write(tsBytes)
-
-	return hex.EncodeToString(mac.Sum(nil))
+	return core.Sign(payload, timestamp, hmacSecretKey)
 }
 
 // generatePayload creates random payload
@@ -62,8 +55,50 @@ func randomIP() string {
 	return fmt.Sprintf("192.168.%d.%d", rand.Intn(256), rand.Intn(256))
 }
 
-// worker simulates a botnet node
-func worker(ctx context.Context, id int, stats *Stats, wg *sync.WaitGroup) {
+// uniformTraffic emits the original flat mix as fast as workers take it
+func uniformTraffic(ctx context.Context, out chan<- *pb.LogRequest) {
+	for {
+		payload := generatePayload()
+		timestamp := time.Now().UnixNano()
+
+		var ip, sig string
+		roll := rand.Float64()
+
+		switch {
+		case roll < 0.90:
+			// 90% - Valid signature, random IP (normal high traffic)
+			ip = randomIP()
+			sig = generateSignature(payload, timestamp)
+
+		case roll < 0.95:
+			// 5% - Invalid signature (tampering/hacking attempt)
+			ip = randomIP()
+			sig = "invalid-tampered-signature"
+
+		default:
+			// 5% - DDoS: spam from same IP to trigger rate limit
+			ip = ddosIP
+			sig = generateSignature(payload, timestamp)
+		}
+
+		req := &pb.LogRequest{
+			IpAddress: ip,
+			Payload:   payload,
+			Timestamp: timestamp,
+			Signature: sig,
+		}
+		select {
+		case out <- req:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// worker simulates a botnet node, sending whatever the traffic generator
+// hands it on its own stream. Like an agent, it holds back a client the
+// server tarpits or throttles and puts its requests back in the queue.
+func worker(ctx context.Context, id int, requests chan *pb.LogRequest, holds *Holds, stats *Stats, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	conn, err := grpc.Dial(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -80,6 +115,10 @@ func worker(ctx context.Context, id int, stats *Stats, wg *sync.WaitGroup) {
 		return
 	}
 
+	// Responses come back in request order, so the IP each one is for is
+	// queued as its request goes out
+	inFlight := make(chan string, 1024)
+
 	// Response receiver goroutine
 	go func() {
 		for {
@@ -93,83 +132,115 @@ func worker(ctx context.Context, id int, stats *Stats, wg *sync.WaitGroup) {
 				}
 				return
 			}
+			holds.Hold(<-inFlight, holdFor(resp), time.Now())
 
-			switch resp.GetStatus() {
-			case "ALLOWED":
+			switch {
+			case resp.GetDecision() == pb.Decision_DECISION_ALLOWED:
 				stats.allowed.Add(1)
-			case "BLOCKED_RATE_LIMIT":
+			case resp.GetReason() == pb.Reason_REASON_RATE_LIMIT:
 				stats.blockedRate.Add(1)
-			case "BLOCKED_INVALID_SIG":
+			case resp.GetReason() == pb.Reason_REASON_INVALID_SIGNATURE:
 				stats.blockedSig.Add(1)
+			default:
+				stats.blockedMore.Add(1)
 			}
 		}
 	}()
 
-	// Request sender - infinite loop
+	// Request sender
 	for {
+		var req *pb.LogRequest
 		select {
 		case <-ctx.Done():
 			stream.CloseSend()
 			return
-		default:
-			payload := generatePayload()
-			timestamp := time.Now().UnixNano()
-
-			var ip, sig string
-			roll := rand.Float64()
-
-			switch {
-			case roll < 0.90:
-				// 90% - Valid signature, random IP (normal high traffic)
-				ip = randomIP()
-				sig = generateSignature(payload, timestamp)
-
-			case roll < 0.95:
-				// 5% - Invalid signature (tampering/hacking attempt)
-				ip = randomIP()
-				sig = "invalid-tampered-signature"
+		case req = <-requests:
+		}
 
-			default:
-				// 5% - DDoS: spam from same IP to trigger rate limit
-				ip = ddosIP
-				sig = generateSignature(payload, timestamp)
-			}
+		if wait := holds.Remaining(req.GetIpAddress(), time.Now()); wait > 0 {
+			stats.held.Add(1)
+			go requeue(ctx, requests, req, wait)
+			continue
+		}
 
-			req := &pb.LogRequest{
-				IpAddress: ip,
-				Payload:   payload,
-				Timestamp: timestamp,
-				Signature: sig,
+		select {
+		case <-ctx.Done():
+			stream.CloseSend()
+			return
+		case inFlight <- req.GetIpAddress():
+		}
+		if err := stream.Send(req); err != nil {
+			if ctx.Err() == nil {
+				stats.errors.Add(1)
 			}
+			return
+		}
+		stats.sent.Add(1)
 
-			if err := stream.Send(req); err != nil {
-				if ctx.Err() == nil {
-					stats.errors.Add(1)
-				}
-				return
-			}
-			stats.sent.Add(1)
+		// Small delay to prevent CPU saturation
+		time.Sleep(time.Millisecond)
+	}
+}
 
-			// Small delay to prevent CPU saturation
-			time.Sleep(time.Millisecond)
-		}
+// requeue hands req back to the workers once its client's hold is over
+func requeue(ctx context.Context, requests chan<- *pb.LogRequest, req *pb.LogRequest, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+	select {
+	case <-ctx.Done():
+	case requests <- req:
 	}
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
+	model := DefaultTrafficModel()
+	mode := flag.String("model", "uniform", "traffic model: uniform (flat attack mix) or realistic (daily curve, sessions, bursts)")
+	seed := flag.Int64("seed", 0, "random seed for the realistic model (0 picks one)")
+	flag.Float64Var(&model.PeakSessions, "peak-sessions", model.PeakSessions, "realistic: new user sessions per second at the daily peak")
+	flag.Float64Var(&model.TroughRatio, "trough-ratio", model.TroughRatio, "realistic: nightly arrival rate as a share of the peak")
+	flag.DurationVar(&model.DayLength, "day-length", model.DayLength, "realistic: length of one simulated day, e.g. 10m to sweep a day quickly")
+	flag.Float64Var(&model.PeakHour, "peak-hour", model.PeakHour, "realistic: busiest hour of the simulated day")
+	flag.Float64Var(&model.MeanSessionRequests, "session-requests", model.MeanSessionRequests, "realistic: mean requests per session")
+	flag.DurationVar(&model.MeanThinkTime, "think-time", model.MeanThinkTime, "realistic: mean pause between a user's page views")
+	flag.Float64Var(&model.PayloadAlpha, "payload-alpha", model.PayloadAlpha, "realistic: Pareto shape of payload sizes (lower is heavier-tailed)")
+	flag.Float64Var(&model.TamperShare, "tamper-share", model.TamperShare, "realistic: share of sessions sending bad signatures")
+	flag.DurationVar(&model.BurstEvery, "burst-every", model.BurstEvery, "realistic: mean time between single-IP floods (0 disables)")
+	flag.DurationVar(&model.BurstDuration, "burst-duration", model.BurstDuration, "realistic: length of each flood")
+	flag.Float64Var(&model.BurstRPS, "burst-rps", model.BurstRPS, "realistic: requests per second during a flood")
+	flag.Parse()
+
+	if *mode != "uniform" && *mode != "realistic" {
+		log.Fatalf("-model must be uniform or realistic, got %q", *mode)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rand.Seed(*seed)
 
 	fmt.Println("╔══════════════════════════════════════════╗")
 	fmt.Println("║       DDoS ATTACK SIMULATOR              ║")
 	fmt.Println("╠══════════════════════════════════════════╣")
 	fmt.Printf("║ Server:       %s              ║\n", serverAddr)
 	fmt.Printf("║ Workers:      %d (concurrent)            ║\n", numWorkers)
-	fmt.Println("║ Attack Mix:                              ║")
-	fmt.Println("║   90%% Valid traffic (random IPs)        ║")
-	fmt.Println("║    5%% Invalid signatures (tampering)    ║")
-	fmt.Println("║    5%% DDoS spam (fixed IP: 10.0.0.1)    ║")
+	if *mode == "uniform" {
+		fmt.Println("║ Attack Mix:                              ║")
+		fmt.Println("║   90%% Valid traffic (random IPs)        ║")
+		fmt.Println("║    5%% Invalid signatures (tampering)    ║")
+		fmt.Println("║    5%% DDoS spam (fixed IP: 10.0.0.1)    ║")
+	} else {
+		fmt.Println("║ Realistic Model:                         ║")
+		fmt.Printf("║   Peak %6.1f sessions/s, day = %-9v ║\n", model.PeakSessions, model.DayLength)
+		fmt.Printf("║   Pareto payloads (alpha %.2f)           ║\n", model.PayloadAlpha)
+		fmt.Printf("║   Floods every ~%-9v at %5.0f rps    ║\n", model.BurstEvery, model.BurstRPS)
+		fmt.Printf("║   Seed %-20d              ║\n", *seed)
+	}
 	fmt.Println("╚══════════════════════════════════════════╝")
-	fmt.Println("\nPress Ctrl+C to stop...\n")
+	fmt.Print("\nPress Ctrl+C to stop...\n\n")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -185,11 +256,20 @@ func main() {
 
 	var stats Stats
 	var wg sync.WaitGroup
+	holds := NewHolds()
+
+	// Traffic generator feeding the workers
+	requests := make(chan *pb.LogRequest, numWorkers)
+	if *mode == "realistic" {
+		go model.Run(ctx, rand.New(rand.NewSource(*seed)), requests)
+	} else {
+		go uniformTraffic(ctx, requests)
+	}
 
 	// Spawn workers (botnet simulation)
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go worker(ctx, i, &stats, &wg)
+		go worker(ctx, i, requests, holds, &stats, &wg)
 	}
 
 	// Stats printer - every second
@@ -202,11 +282,13 @@ func main() {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				fmt.Printf("Sent: %6d | Allowed: %6d | Blocked (Sig): %6d | Blocked (Rate): %6d | Errors: %d\n",
+				fmt.Printf("Sent: %6d | Allowed: %6d | Blocked (Sig): %6d | Blocked (Rate): %6d | Blocked (Other): %6d | Held: %6d | Errors: %d\n",
 					stats.sent.Load(),
 					stats.allowed.Load(),
 					stats.blockedSig.Load(),
 					stats.blockedRate.Load(),
+					stats.blockedMore.Load(),
+					stats.held.Load(),
 					stats.errors.Load(),
 				)
 			}
@@ -223,6 +305,8 @@ func main() {
 	fmt.Printf("║ Allowed:            %10d           ║\n", stats.allowed.Load())
 	fmt.Printf("║ Blocked (Sig):      %10d           ║\n", stats.blockedSig.Load())
 	fmt.Printf("║ Blocked (Rate):     %10d           ║\n", stats.blockedRate.Load())
+	fmt.Printf("║ Blocked (Other):    %10d           ║\n", stats.blockedMore.Load())
+	fmt.Printf("║ Held:               %10d           ║\n", stats.held.Load())
 	fmt.Printf("║ Errors:             %10d           ║\n", stats.errors.Load())
 	fmt.Println("╚══════════════════════════════════════════╝")
 }
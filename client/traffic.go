@@ -0,0 +1,218 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+const schedulerTick = 10 * time.Millisecond
+
+// TrafficModel shapes realistic traffic: users arrive along a daily curve,
+// browse in sessions of clustered requests with pauses in between, and send
+// heavy-tailed payloads. Attack bursts and tampering ride on top of it.
+type TrafficModel struct {
+	PeakSessions float64       // New sessions per second at the daily peak
+	TroughRatio  float64       // Arrival rate at the daily low, as a share of the peak
+	DayLength    time.Duration // Length of one simulated day; shorten it to sweep a whole day quickly
+	PeakHour     float64       // Hour of the simulated day with the most traffic
+
+	MeanSessionRequests float64       // Requests per session (exponential)
+	MeanThinkTime       time.Duration // Pause between page views (exponential)
+	PageBurstMax        int           // Requests sent back to back per page view, 1 to this
+
+	PayloadMin   int     // Pareto scale: the smallest payload
+	PayloadAlpha float64 // Pareto shape; lower means a heavier tail
+	PayloadMax   int     // Payloads are capped here
+
+	TamperShare   float64       // Share of sessions that send bad signatures
+	BurstEvery    time.Duration // Mean time between single-IP floods (exponential), 0 disables them
+	BurstDuration time.Duration
+	BurstRPS      float64
+}
+
+// DefaultTrafficModel returns a model of a mid-sized site
+func DefaultTrafficModel() TrafficModel {
+	return TrafficModel{
+		PeakSessions:        20,
+		TroughRatio:         0.15,
+		DayLength:           24 * time.Hour,
+		PeakHour:            14,
+		MeanSessionRequests: 15,
+		MeanThinkTime:       3 * time.Second,
+		PageBurstMax:        6,
+		PayloadMin:          64,
+		PayloadAlpha:        1.5,
+		PayloadMax:          32 << 10,
+		TamperShare:         0.01,
+		BurstEvery:          5 * time.Minute,
+		BurstDuration:       20 * time.Second,
+		BurstRPS:            500,
+	}
+}
+
+// SessionRate returns new sessions per second at elapsed time into the run.
+// The run starts at midnight of the simulated day.
+func (m TrafficModel) SessionRate(elapsed time.Duration) float64 {
+	hour := 24 * math.Mod(float64(elapsed)/float64(m.DayLength), 1)
+	// Cosine with its maximum at PeakHour and minimum twelve hours later
+	shape := (1 + math.Cos(2*math.Pi*(hour-m.PeakHour)/24)) / 2
+	return m.PeakSessions * (m.TroughRatio + (1-m.TroughRatio)*shape)
+}
+
+// PayloadSize draws a Pareto-distributed payload size
+func (m TrafficModel) PayloadSize(rng *rand.Rand) int {
+	size := float64(m.PayloadMin) / math.Pow(1-rng.Float64(), 1/m.PayloadAlpha)
+	if size > float64(m.PayloadMax) {
+		return m.PayloadMax
+	}
+	return int(size)
+}
+
+// poisson draws the number of events in an interval expecting mean of them
+func poisson(rng *rand.Rand, mean float64) int {
+	if mean > 30 {
+		return int(math.Max(0, math.Round(rng.NormFloat64()*math.Sqrt(mean)+mean)))
+	}
+	n, p, limit := 0, 1.0, math.Exp(-mean)
+	for {
+		p *= rng.Float64()
+		if p <= limit {
+			return n
+		}
+		n++
+	}
+}
+
+// session is one visitor working through its requests
+type session struct {
+	ip        string
+	remaining int
+	tamper    bool
+	next      time.Time
+}
+
+type sessionQueue []*session
+
+func (q sessionQueue) Len() int           { return len(q) }
+func (q sessionQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q sessionQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *sessionQueue) Push(x any)        { *q = append(*q, x.(*session)) }
+func (q *sessionQueue) Pop() any {
+	old := *q
+	s := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return s
+}
+
+// burst is a single IP flooding the server
+type burst struct {
+	ip    string
+	until time.Time
+	owed  float64 // Fractional requests carried to the next tick
+}
+
+// Run emits requests following the model until ctx is cancelled
+func (m TrafficModel) Run(ctx context.Context, rng *rand.Rand, out chan<- *pb.LogRequest) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	sessions := &sessionQueue{}
+	var flood *burst
+	nextBurst := m.nextBurst(rng, start)
+
+	emit := func(ip string, tamper bool, now time.Time) bool {
+		select {
+		case out <- m.request(rng, ip, tamper, now):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+
+		// New visitors
+		for i := poisson(rng, m.SessionRate(now.Sub(start))*schedulerTick.Seconds()); i > 0; i-- {
+			heap.Push(sessions, &session{
+				ip:        visitorIP(rng),
+				remaining: 1 + int(rng.ExpFloat64()*(m.MeanSessionRequests-1)),
+				tamper:    rng.Float64() < m.TamperShare,
+				next:      now,
+			})
+		}
+
+		// Page views that are due
+		for sessions.Len() > 0 && !(*sessions)[0].next.After(now) {
+			s := heap.Pop(sessions).(*session)
+			for n := 1 + rng.Intn(m.PageBurstMax); n > 0 && s.remaining > 0; n-- {
+				if !emit(s.ip, s.tamper, now) {
+					return
+				}
+				s.remaining--
+			}
+			if s.remaining > 0 {
+				s.next = now.Add(time.Duration(rng.ExpFloat64() * float64(m.MeanThinkTime)))
+				heap.Push(sessions, s)
+			}
+		}
+
+		// Floods
+		if flood == nil && !nextBurst.IsZero() && !now.Before(nextBurst) {
+			flood = &burst{ip: fmt.Sprintf("10.0.%d.%d", rng.Intn(256), 1+rng.Intn(254)), until: now.Add(m.BurstDuration)}
+			nextBurst = m.nextBurst(rng, now)
+		}
+		if flood != nil {
+			flood.owed += m.BurstRPS * schedulerTick.Seconds()
+			for ; flood.owed >= 1; flood.owed-- {
+				if !emit(flood.ip, false, now) {
+					return
+				}
+			}
+			if now.After(flood.until) {
+				flood = nil
+			}
+		}
+	}
+}
+
+func (m TrafficModel) nextBurst(rng *rand.Rand, now time.Time) time.Time {
+	if m.BurstEvery <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(rng.ExpFloat64() * float64(m.BurstEvery)))
+}
+
+func (m TrafficModel) request(rng *rand.Rand, ip string, tamper bool, now time.Time) *pb.LogRequest {
+	payload := make([]byte, m.PayloadSize(rng))
+	rng.Read(payload)
+	timestamp := now.UnixNano()
+
+	sig := generateSignature(payload, timestamp)
+	if tamper {
+		sig = "invalid-tampered-signature"
+	}
+	return &pb.LogRequest{
+		IpAddress: ip,
+		Payload:   payload,
+		Timestamp: timestamp,
+		Signature: sig,
+	}
+}
+
+// visitorIP picks a source address for a new session
+func visitorIP(rng *rand.Rand) string {
+	return fmt.Sprintf("172.%d.%d.%d", 16+rng.Intn(16), rng.Intn(256), 1+rng.Intn(254))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSessionRateFollowsDay(t *testing.T) {
+	m := DefaultTrafficModel()
+	m.DayLength = 24 * time.Minute // One simulated hour per minute
+
+	peak := m.SessionRate(14 * time.Minute)
+	trough := m.SessionRate(2 * time.Minute)
+	if math.Abs(peak-m.PeakSessions) > 1e-9 {
+		t.Errorf("rate at the peak hour = %v, want %v", peak, m.PeakSessions)
+	}
+	if want := m.PeakSessions * m.TroughRatio; math.Abs(trough-want) > 1e-9 {
+		t.Errorf("rate twelve hours later = %v, want %v", trough, want)
+	}
+	if next := m.SessionRate(m.DayLength + 14*time.Minute); math.Abs(next-peak) > 1e-9 {
+		t.Errorf("rate on the second day = %v, want %v", next, peak)
+	}
+}
+
+func TestPayloadSizeIsHeavyTailed(t *testing.T) {
+	m := DefaultTrafficModel()
+	rng := rand.New(rand.NewSource(1))
+
+	small, capped := 0, 0
+	const n = 100000
+	for i := 0; i < n; i++ {
+		size := m.PayloadSize(rng)
+		if size < m.PayloadMin || size > m.PayloadMax {
+			t.Fatalf("size %d outside [%d, %d]", size, m.PayloadMin, m.PayloadMax)
+		}
+		if size < 2*m.PayloadMin {
+			small++
+		}
+		if size == m.PayloadMax {
+			capped++
+		}
+	}
+
+	// P(X < 2·xm) = 1 - 2^-alpha
+	if got, want := float64(small)/n, 1-math.Pow(2, -m.PayloadAlpha); math.Abs(got-want) > 0.01 {
+		t.Errorf("share under twice the minimum = %.3f, want %.3f", got, want)
+	}
+	if capped == 0 {
+		t.Errorf("no payload reached the cap; the tail is too light")
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shashank/intrusiondetection/server"
+	"github.com/spf13/cobra"
+)
+
+func blockCommand(c *adminClient) *cobra.Command {
+	var ttl time.Duration
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "block <ip|cidr>",
+		Short: "Add an IP or range to the blocklist",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := server.BlockRequest{Target: args[0], Reason: reason, TTL: server.Duration(ttl)}
+			var entry server.BlockEntry
+			if err := c.call(cmd.Context(), http.MethodPost, "/api/blocklist", req, &entry); err != nil {
+				return err
+			}
+			if entry.ExpiresAt == 0 {
+				fmt.Printf("Blocked %s permanently\n", entry.Target)
+			} else {
+				fmt.Printf("Blocked %s until %s\n", entry.Target, time.Unix(entry.ExpiresAt, 0).Format(time.RFC3339))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "unblock automatically after this long (0 = permanent)")
+	cmd.Flags().StringVar(&reason, "reason", "", "reason recorded with the block")
+	return cmd
+}
+
+func unblockCommand(c *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unblock <ip|cidr>",
+		Short: "Remove an IP or range from the blocklist and lift any rate-limit block",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/api/blocklist?target=" + url.QueryEscape(args[0])
+			if err := c.call(cmd.Context(), http.MethodDelete, path, nil, nil); err != nil {
+				return err
+			}
+			fmt.Printf("Unblocked %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func blocklistCommand(c *adminClient) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "blocklist",
+		Short: "List the blocklist, or export it as text, csv or ipset",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" {
+				data, err := c.do(cmd.Context(), http.MethodGet, "/api/blocklist/export?format="+url.QueryEscape(format), nil)
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			var entries []server.BlockEntry
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/blocklist", nil, &entries); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TARGET\tEXPIRES\tSOURCE\tREASON")
+			for _, e := range entries {
+				expires := "never"
+				if e.ExpiresAt != 0 {
+					expires = time.Until(time.Unix(e.ExpiresAt, 0)).Round(time.Second).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Target, expires, e.Source, e.Reason)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "table", "output format: table, text, csv or ipset")
+	return cmd
+}
+
+func talkersCommand(c *adminClient) *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "talkers",
+		Short: "Show the source IPs with the most requests in the last minute or two",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var talkers []server.Talker
+			if err := c.call(cmd.Context(), http.MethodGet, fmt.Sprintf("/api/talkers?limit=%d", limit), nil, &talkers); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "IP\tREQUESTS\tBLOCKED")
+			for _, t := range talkers {
+				fmt.Fprintf(w, "%s\t%d\t%d\n", t.IP, t.Requests, t.Blocked)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "number of IPs to show")
+	return cmd
+}
+
+func geoCommand(c *adminClient) *cobra.Command {
+	var window time.Duration
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "geo",
+		Short: "Show traffic and blocks by country and ASN across all servers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var geo server.GeoSnapshot
+			path := fmt.Sprintf("/api/geo?window=%s&limit=%d", window, limit)
+			if err := c.call(cmd.Context(), http.MethodGet, path, nil, &geo); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "COUNTRY\tREQUESTS\tBLOCKED")
+			for _, g := range geo.Countries {
+				fmt.Fprintf(w, "%s\t%d\t%d\n", g.Country, g.Requests, g.Blocked)
+			}
+			fmt.Fprintln(w, "\nASN\tORG\tREQUESTS\tBLOCKED")
+			for _, g := range geo.ASNs {
+				fmt.Fprintf(w, "AS%d\t%s\t%d\t%d\n", g.ASN, g.Org, g.Requests, g.Blocked)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().DurationVar(&window, "window", 15*time.Minute, "how far back to count")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "countries and ASNs to show")
+	return cmd
+}
+
+func streamsCommand(c *adminClient) *cobra.Command {
+	disconnect := &cobra.Command{
+		Use:   "disconnect <id>",
+		Short: "Force an agent's stream closed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/api/streams?id=" + url.QueryEscape(args[0])
+			if err := c.call(cmd.Context(), http.MethodDelete, path, nil, nil); err != nil {
+				return err
+			}
+			fmt.Printf("Disconnected stream %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "streams",
+		Short: "List connected agent streams",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var streams []server.StreamInfo
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/streams", nil, &streams); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tPEER\tAGE\tMESSAGES\tBLOCKED\tMSG/S\tLAST IP\tUSER AGENT")
+			for _, s := range streams {
+				age := (time.Duration(s.DurationSeconds) * time.Second).Round(time.Second)
+				fmt.Fprintf(w, "%d\t%s\t%v\t%d\t%d\t%.1f\t%s\t%s\n",
+					s.ID, s.Peer, age, s.Messages, s.Blocked, s.MessagesPerSec, s.LastIP, s.UserAgent)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.AddCommand(disconnect)
+	return cmd
+}
+
+func alertsCommand(c *adminClient) *cobra.Command {
+	var wsURL string
+	var since, until, severity, kind, ip, cursor string
+	var limit int
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Show stored alerts, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := url.Values{}
+			for name, v := range map[string]string{"since": since, "until": until, "severity": severity, "kind": kind, "ip": ip, "cursor": cursor} {
+				if v != "" {
+					params.Set(name, v)
+				}
+			}
+			params.Set("limit", strconv.Itoa(limit))
+
+			var page server.AlertPage
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/alerts?"+params.Encode(), nil, &page); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tSEVERITY\tKIND\tIP\tMESSAGE")
+			for _, a := range page.Alerts {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					time.Unix(a.Timestamp, 0).Format(time.DateTime), a.Severity, a.Kind, a.IP, a.Message)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if page.NextCursor != "" {
+				fmt.Printf("\nMore: idctl alerts list --cursor %s\n", page.NextCursor)
+			}
+			return nil
+		},
+	}
+	list.Flags().StringVar(&since, "since", "", "alerts after this (RFC 3339 or a duration like 24h)")
+	list.Flags().StringVar(&until, "until", "", "alerts before this (RFC 3339 or a duration)")
+	list.Flags().StringVar(&severity, "severity", "", "comma-separated severities, e.g. warning,critical")
+	list.Flags().StringVar(&kind, "kind", "", "comma-separated alert kinds, e.g. under_attack,replay_detected")
+	list.Flags().StringVar(&ip, "ip", "", "only alerts about this IP")
+	list.Flags().StringVar(&cursor, "cursor", "", "continue from a previous page")
+	list.Flags().IntVarP(&limit, "limit", "n", 50, "alerts per page")
+
+	tail := &cobra.Command{
+		Use:   "tail",
+		Short: "Stream alerts from the dashboard WebSocket until interrupted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, _, err := websocket.DefaultDialer.DialContext(cmd.Context(), wsURL, nil)
+			if err != nil {
+				return fmt.Errorf("connect to %s: %w", wsURL, err)
+			}
+			defer conn.Close()
+
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return err
+				}
+				var msg map[string]any
+				if json.Unmarshal(data, &msg) != nil {
+					continue
+				}
+				// Per-second stats carry no type; everything typed is an alert
+				kind, ok := msg["type"].(string)
+				if !ok {
+					continue
+				}
+				delete(msg, "type")
+				fmt.Printf("%s %-10s %s\n", time.Now().Format("15:04:05"), kind, formatFields(msg))
+			}
+		},
+	}
+	tail.Flags().StringVar(&wsURL, "ws", envOr("IDS_WS_URL", "ws://localhost:8080/ws"), "dashboard WebSocket URL ($IDS_WS_URL)")
+
+	cmd := &cobra.Command{
+		Use:   "alerts",
+		Short: "Work with alerts",
+	}
+	cmd.AddCommand(list, tail)
+	return cmd
+}
+
+// formatFields renders a JSON object as sorted key=value pairs
+func formatFields(fields map[string]any) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, _ := json.Marshal(fields[k])
+		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+func modeCommand(c *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "mode [enforce|monitor]",
+		Short: "Show or switch the enforcement mode",
+		Long:  "In monitor mode the server records what it would block but lets every request through.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var mode server.ModePayload
+			var err error
+			if len(args) == 0 {
+				err = c.call(cmd.Context(), http.MethodGet, "/api/mode", nil, &mode)
+			} else {
+				err = c.call(cmd.Context(), http.MethodPut, "/api/mode", server.ModePayload{Mode: args[0]}, &mode)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(mode.Mode)
+			return nil
+		},
+	}
+}
+
+// formatCanary summarises the canary for idctl status
+func formatCanary(c server.CanaryStatus) string {
+	switch {
+	case !c.Enabled:
+		return "disabled"
+	case c.LastRun == 0:
+		return "waiting for first probe"
+	case c.Healthy:
+		return fmt.Sprintf("ok (%.1f ms)", c.LatencyMs)
+	default:
+		return fmt.Sprintf("FAILING x%d: %s", c.ConsecutiveFailures, c.Message)
+	}
+}
+
+func attackCommand(c *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "attack [on|off|auto]",
+		Short: "Show under-attack mode, or pin it on or off",
+		Long:  "Under attack the server tightens its limits. \"auto\" hands control back to the detector.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var status server.AttackStatus
+			var err error
+			if len(args) == 0 {
+				err = c.call(cmd.Context(), http.MethodGet, "/api/attack", nil, &status)
+			} else {
+				err = c.call(cmd.Context(), http.MethodPut, "/api/attack", server.AttackOverridePayload{Override: args[0]}, &status)
+			}
+			if err != nil {
+				return err
+			}
+
+			state := "calm"
+			if status.Active {
+				state = "UNDER ATTACK"
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "State:\t%s (override %s)\n", state, status.Override)
+			if status.Since != 0 {
+				fmt.Fprintf(w, "Since:\t%s\n", time.Unix(status.Since, 0).Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "Signals:\t%s\n", status.Signals)
+			fmt.Fprintf(w, "RPS:\t%d (baseline %.0f)\n", status.RPS, status.BaselineRPS)
+			fmt.Fprintf(w, "Block ratio:\t%.1f%%\n", status.BlockRatio*100)
+			return w.Flush()
+		},
+	}
+}
+
+func chaosCommand(c *adminClient) *cobra.Command {
+	var redisLatency, aiDelay, wsStall, duration time.Duration
+	var redisErrors float64
+
+	show := func(f server.Faults) error {
+		if f.ExpiresAt == 0 {
+			fmt.Println("No faults injected")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Redis latency:\t%v\n", f.RedisLatency)
+		fmt.Fprintf(w, "Redis errors:\t%.1f%%\n", f.RedisErrorRate*100)
+		fmt.Fprintf(w, "AI worker delay:\t%v\n", f.AIWorkerDelay)
+		fmt.Fprintf(w, "WebSocket stall:\t%v\n", f.WebSocketStall)
+		fmt.Fprintf(w, "Until:\t%s\n", time.Unix(f.ExpiresAt, 0).Format(time.RFC3339))
+		return w.Flush()
+	}
+
+	set := &cobra.Command{
+		Use:   "set",
+		Short: "Inject faults, replacing any already set",
+		Long:  "Faults clear themselves after --for. The server must run with allow_faults.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := server.Faults{
+				RedisLatency:   server.Duration(redisLatency),
+				RedisErrorRate: redisErrors,
+				AIWorkerDelay:  server.Duration(aiDelay),
+				WebSocketStall: server.Duration(wsStall),
+				Duration:       server.Duration(duration),
+			}
+			var faults server.Faults
+			if err := c.call(cmd.Context(), http.MethodPut, "/api/chaos", req, &faults); err != nil {
+				return err
+			}
+			return show(faults)
+		},
+	}
+	set.Flags().DurationVar(&redisLatency, "redis-latency", 0, "latency added to every Redis command")
+	set.Flags().Float64Var(&redisErrors, "redis-errors", 0, "share of Redis commands that fail, 0 to 1")
+	set.Flags().DurationVar(&aiDelay, "ai-delay", 0, "delay before each AI worker alert is handled")
+	set.Flags().DurationVar(&wsStall, "ws-stall", 0, "stall before each dashboard broadcast")
+	set.Flags().DurationVar(&duration, "for", 5*time.Minute, "how long the faults last")
+
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Stop injecting faults",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.call(cmd.Context(), http.MethodDelete, "/api/chaos", nil, nil); err != nil {
+				return err
+			}
+			fmt.Println("Faults cleared")
+			return nil
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "chaos",
+		Short: "Show, inject or clear dependency faults",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var faults server.Faults
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/chaos", nil, &faults); err != nil {
+				return err
+			}
+			return show(faults)
+		},
+	}
+	cmd.AddCommand(set, clearCmd)
+	return cmd
+}
+
+func reloadCommand(c *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "Re-read the server's config file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.call(cmd.Context(), http.MethodPost, "/api/config/reload", nil, nil); err != nil {
+				return err
+			}
+			fmt.Println("Config reloaded")
+			return nil
+		},
+	}
+}
+
+func statusCommand(c *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show server runtime counters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var rt server.RuntimePayload
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/runtime", nil, &rt); err != nil {
+				return err
+			}
+			var mode server.ModePayload
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/mode", nil, &mode); err != nil {
+				return err
+			}
+
+			var canary server.CanaryStatus
+			if err := c.call(cmd.Context(), http.MethodGet, "/api/canary", nil, &canary); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "Mode:\t%s\n", mode.Mode)
+			fmt.Fprintf(w, "Canary:\t%s\n", formatCanary(canary))
+			fmt.Fprintf(w, "Uptime:\t%v\n", time.Duration(rt.UptimeSeconds)*time.Second)
+			fmt.Fprintf(w, "gRPC streams:\t%d\n", rt.GRPCStreams)
+			fmt.Fprintf(w, "WebSocket clients:\t%d\n", rt.WebSocketClients)
+			fmt.Fprintf(w, "Goroutines:\t%d\n", rt.Goroutines)
+			fmt.Fprintf(w, "Heap:\t%.1f MiB\n", float64(rt.HeapAllocBytes)/(1<<20))
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,49 @@
+// Command idctl is the operator CLI for the intrusion detection server's admin API
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	client := &adminClient{}
+
+	root := &cobra.Command{
+		Use:           "idctl",
+		Short:         "Manage a running intrusion detection server",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&client.baseURL, "admin", envOr("IDS_ADMIN_URL", "http://localhost:6060"), "admin API address ($IDS_ADMIN_URL)")
+	root.PersistentFlags().StringVar(&client.token, "token", os.Getenv("IDS_ADMIN_TOKEN"), "admin bearer token ($IDS_ADMIN_TOKEN)")
+
+	root.AddCommand(
+		blockCommand(client),
+		unblockCommand(client),
+		blocklistCommand(client),
+		talkersCommand(client),
+		geoCommand(client),
+		streamsCommand(client),
+		alertsCommand(client),
+		modeCommand(client),
+		attackCommand(client),
+		chaosCommand(client),
+		reloadCommand(client),
+		statusCommand(client),
+	)
+
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "idctl:", err)
+		os.Exit(1)
+	}
+}
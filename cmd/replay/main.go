@@ -0,0 +1,279 @@
+// Command replay sends recorded traffic to a server at its original pace (or
+// faster) and reports how each decision compares with the original one.
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shashank/intrusiondetection/core"
+	pb "github.com/shashank/intrusiondetection/proto"
+	"github.com/shashank/intrusiondetection/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	invalidSignature  = "replayed-invalid-signature"
+	monitorModePrefix = "Monitor mode: would be "
+)
+
+func main() {
+	defaults := server.DefaultConfig()
+	addr := flag.String("addr", "localhost:50051", "gRPC address of the server to replay against")
+	secret := flag.String("secret", defaults.SecretKey, "HMAC key used to re-sign requests")
+	file := flag.String("file", "", "JSONL export to replay (\"-\" for stdin); reads Redis when empty")
+	redisAddr := flag.String("redis", defaults.RedisAddr, "Redis holding the event log")
+	sinceArg := flag.String("since", "", "replay events received after this (RFC 3339 or a duration like 2h)")
+	untilArg := flag.String("until", "", "replay events received before this (RFC 3339 or a duration)")
+	speed := flag.Float64("speed", 1, "playback speed multiplier; 0 sends as fast as possible")
+	originalTimestamps := flag.Bool("original-timestamps", false, "send the recorded timestamps instead of shifting them to now")
+	flag.Parse()
+
+	now := time.Now()
+	since, err := server.ParseTime(*sinceArg, now)
+	if err != nil {
+		log.Fatalf("-since: %v", err)
+	}
+	until, err := server.ParseTime(*untilArg, now)
+	if err != nil {
+		log.Fatalf("-until: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events, err := loadEvents(ctx, *file, *redisAddr, since, until)
+	if err != nil {
+		log.Fatalf("Failed to load events: %v", err)
+	}
+	if len(events) == 0 {
+		log.Fatal("No events to replay")
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ReceivedAt < events[j].ReceivedAt })
+
+	span := time.Duration(events[len(events)-1].ReceivedAt-events[0].ReceivedAt) * time.Millisecond
+	log.Printf("Replaying %d events spanning %v against %s at %gx", len(events), span, *addr, *speed)
+
+	tally, err := replay(ctx, *addr, *secret, events, *speed, *originalTimestamps)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Replay stopped: %v", err)
+	}
+	tally.print(os.Stdout)
+}
+
+// loadEvents reads events from a JSONL file, or from the Redis event log
+func loadEvents(ctx context.Context, file, redisAddr string, since, until time.Time) ([]server.Event, error) {
+	var events []server.Event
+	keep := func(e server.Event) error {
+		at := time.UnixMilli(e.ReceivedAt)
+		if (since.IsZero() || !at.Before(since)) && (until.IsZero() || !at.After(until)) {
+			events = append(events, e)
+		}
+		return nil
+	}
+
+	if file == "" {
+		rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+		defer rdb.Close()
+		err := server.ReadEvents(ctx, rdb, since, until, keep)
+		return events, err
+	}
+
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dec := json.NewDecoder(in)
+	for {
+		var e server.Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keep(e)
+	}
+}
+
+// replay sends events over one stream, keeping their relative timing
+func replay(ctx context.Context, addr, secret string, events []server.Event, speed float64, originalTimestamps bool) (*tally, error) {
+	results := newTally()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return results, err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewIntrusionDetectionServiceClient(conn).StreamLogs(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	// Responses come back in request order
+	expected := make(chan string, 1024)
+	received := make(chan error, 1)
+	go func() {
+		var recvErr error
+		for want := range expected {
+			if recvErr != nil {
+				continue // Keep draining so the sender never blocks
+			}
+			resp, err := stream.Recv()
+			if err != nil {
+				recvErr = err
+				continue
+			}
+			results.add(want, decision(resp))
+		}
+		received <- recvErr
+	}()
+
+	missingPayloads := 0
+	start := time.Now()
+	first := events[0].ReceivedAt
+	var sendErr error
+	for _, e := range events {
+		if speed > 0 {
+			offset := time.Duration(float64(time.Duration(e.ReceivedAt-first)*time.Millisecond) / speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			sendErr = ctx.Err()
+			break
+		}
+
+		payload := e.Payload
+		if payload == nil && e.PayloadSize > 0 {
+			payload = make([]byte, e.PayloadSize)
+			missingPayloads++
+		}
+
+		// Keep the original distance between the agent's clock and ours
+		timestamp := e.Timestamp
+		if !originalTimestamps {
+			timestamp = time.Now().UnixNano() + (e.Timestamp - e.ReceivedAt*int64(time.Millisecond))
+		}
+
+		signature := core.Sign(payload, timestamp, secret)
+		if e.Status == "BLOCKED_INVALID_SIG" {
+			signature = invalidSignature
+		}
+
+		expected <- e.Status
+		if err := stream.Send(&pb.LogRequest{
+			IpAddress: sourceIP(e.IP),
+			Timestamp: timestamp,
+			Payload:   payload,
+			Signature: signature,
+		}); err != nil {
+			sendErr = err
+			break
+		}
+	}
+	close(expected)
+	stream.CloseSend()
+
+	if missingPayloads > 0 {
+		log.Printf("%d events had no stored payload and were sent with zero-filled payloads", missingPayloads)
+	}
+	if err := <-received; err != nil && sendErr == nil {
+		sendErr = err
+	}
+	return results, sendErr
+}
+
+// sourceIP returns the address to send an event from. IPs hashed by privacy
+// mode are mapped to stable addresses in 198.18.0.0/15 so each original
+// source still gets its own rate limit.
+func sourceIP(ip string) string {
+	if !strings.HasPrefix(ip, "anon-") {
+		return ip
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], 198<<24|18<<16|h.Sum32()&0x1ffff)
+	return netip.AddrFrom4(b).String()
+}
+
+// decision returns the server's decision, seeing through monitor mode
+func decision(resp *pb.LogResponse) string {
+	if resp.GetMonitor() {
+		status, _, _ := strings.Cut(strings.TrimPrefix(resp.GetMessage(), monitorModePrefix), " ")
+		return status
+	}
+	return resp.GetStatus()
+}
+
+// tally counts original → replayed decision pairs
+type tally struct {
+	counts map[[2]string]int
+	total  int
+}
+
+func newTally() *tally {
+	return &tally{counts: make(map[[2]string]int)}
+}
+
+func (t *tally) add(original, replayed string) {
+	t.counts[[2]string{original, replayed}]++
+	t.total++
+}
+
+func (t *tally) print(out io.Writer) {
+	pairs := make([][2]string, 0, len(t.counts))
+	for pair := range t.counts {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	changed := 0
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ORIGINAL\tREPLAYED\tCOUNT")
+	for _, pair := range pairs {
+		marker := ""
+		if pair[0] != pair[1] {
+			marker = "  *"
+			changed += t.counts[pair]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d%s\n", pair[0], pair[1], t.counts[pair], marker)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d of %d decisions changed\n", changed, t.total)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shashank/intrusiondetection/server"
+)
+
+const blocklistUsage = `Usage:
+  server blocklist export [-config file] [-format text|csv|ipset]
+  server blocklist import [-config file] [-format text|csv|ipset] [-ttl 24h] [-reason text] <file-or-url>
+
+Works directly against Redis; running servers pick up changes within seconds.`
+
+// runBlocklistCommand handles `server blocklist ...`
+func runBlocklistCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, blocklistUsage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("blocklist "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	format := fs.String("format", server.FormatText, "list format: text, csv or ipset")
+	ttl := fs.Duration("ttl", 0, "expire imported entries after this long (0 = permanent)")
+	reason := fs.String("reason", "", "reason recorded on imported entries")
+	fs.Parse(args[1:])
+
+	cfg := loadConfig(*configPath)
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	blocklist := server.NewBlocklist(rdb)
+	if cfg.Regions.Enabled() {
+		blocklist.EnableJournal(cfg.Regions.Region)
+	}
+	if err := blocklist.Refresh(ctx); err != nil {
+		log.Fatalf("Failed to load blocklist from Redis at %s: %v", cfg.RedisAddr, err)
+	}
+
+	switch args[0] {
+	case "export":
+		if err := server.WriteBlocklist(os.Stdout, *format, blocklist.Entries()); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+
+	case "import":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, blocklistUsage)
+			os.Exit(2)
+		}
+		source := fs.Arg(0)
+
+		body, err := server.OpenBlocklistSource(ctx, source, true)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", source, err)
+		}
+		defer body.Close()
+
+		template := server.BlockEntry{Source: source, Reason: *reason}
+		if *ttl > 0 {
+			template.ExpiresAt = time.Now().Add(*ttl).Unix()
+		}
+		entries, err := server.ParseBlocklist(body, *format, template)
+		if err != nil {
+			log.Fatalf("Failed to parse %s: %v", source, err)
+		}
+		if err := blocklist.Add(ctx, entries); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		fmt.Printf("Imported %d entries from %s\n", len(entries), source)
+
+	default:
+		fmt.Fprintln(os.Stderr, blocklistUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const daemonEnv = "IDS_DAEMON_CHILD" // Set in the re-executed child
+
+// daemonize re-executes the server in a new session with its standard
+// streams on /dev/null and exits the parent. In the child it returns nil.
+func daemonize() error {
+	if os.Getenv(daemonEnv) == "1" {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = null, null, null
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Server started in the background as PID %d\n", cmd.Process.Pid)
+	os.Exit(0)
+	return nil
+}
+
+// processAlive reports whether pid names a running process
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shashank/intrusiondetection/server"
+)
+
+const adminTokenEnv = "IDS_ADMIN_TOKEN" // Overrides admin_token from the config file
+
+// options are the command-line flags of the server
+type options struct {
+	configPath    string
+	pidFile       string
+	logFile       string
+	logMaxSizeMB  int
+	logMaxBackups int
+	daemon        bool
+}
+
+// loadConfig returns the defaults, or the config file at path when one is given
+func loadConfig(path string) server.Config {
+	cfg := server.DefaultConfig()
+	if path != "" {
+		var err error
+		if cfg, err = server.LoadConfig(path); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+	if token := os.Getenv(adminTokenEnv); token != "" {
+		cfg.AdminToken = token
+	}
+	return cfg
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "blocklist":
+			runBlocklistCommand(os.Args[2:])
+			return
+		case "service":
+			runServiceCommand(os.Args[2:])
+			return
+		}
+	}
+
+	var opts options
+	flag.StringVar(&opts.configPath, "config", "", "path to a JSON config file (defaults are used when empty)")
+	flag.StringVar(&opts.pidFile, "pidfile", "", "write the process ID to this file while running")
+	flag.StringVar(&opts.logFile, "logfile", "", "log to this file instead of stderr")
+	flag.IntVar(&opts.logMaxSizeMB, "log-max-size", 100, "rotate the log file after this many MB (0 = never)")
+	flag.IntVar(&opts.logMaxBackups, "log-max-backups", 5, "rotated log files to keep")
+	flag.BoolVar(&opts.daemon, "daemon", false, "detach from the terminal and run in the background (requires -logfile)")
+	flag.Parse()
+
+	if opts.daemon {
+		if opts.logFile == "" {
+			log.Fatal("-daemon requires -logfile")
+		}
+		if err := daemonize(); err != nil {
+			log.Fatalf("Failed to daemonize: %v", err)
+		}
+	}
+
+	if opts.logFile != "" {
+		out, err := openRotatingFile(opts.logFile, int64(opts.logMaxSizeMB)<<20, opts.logMaxBackups)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer out.Close()
+		log.SetOutput(out)
+	}
+
+	if isWindowsService() {
+		runWindowsService(opts)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// run serves until ctx is cancelled. It is shared by the terminal, daemon,
+// systemd and Windows service entry points.
+func run(ctx context.Context, opts options) error {
+	cfg := loadConfig(opts.configPath)
+
+	if opts.pidFile != "" {
+		if err := writePIDFile(opts.pidFile); err != nil {
+			return err
+		}
+		defer os.Remove(opts.pidFile)
+	}
+
+	s, err := server.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	log.Printf("Connected to Redis at %s", cfg.RedisAddr)
+
+	// SIGHUP reloads the config file
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			sdNotify("RELOADING=1")
+			if err := s.Reload(); err != nil {
+				log.Printf("Config reload failed: %v", err)
+			}
+			sdNotify("READY=1")
+		}
+	}()
+
+	// Ready once bans and attack state are loaded from Redis
+	go func() {
+		if s.WaitReady(ctx) == nil {
+			sdNotify("READY=1")
+		}
+	}()
+	if interval := watchdogInterval(); interval > 0 {
+		go runWatchdog(ctx, interval)
+	}
+
+	err = s.Run(ctx)
+	sdNotify("STOPPING=1")
+	return err
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writePIDFile records this process in path. It refuses to overwrite the
+// file while the process it names is still running.
+func writePIDFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("%s: server already running as PID %d", path, pid)
+		}
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func isWindowsService() bool { return false }
+
+func runWindowsService(options) {}
+
+// runServiceCommand explains where service support lives on this platform
+func runServiceCommand([]string) {
+	fmt.Fprintln(os.Stderr, "server service is only available on Windows; on Linux install deploy/systemd/ids-server.service")
+	os.Exit(2)
+}
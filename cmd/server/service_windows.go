@@ -0,0 +1,126 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "ids-server"
+	serviceDisplayName = "Intrusion Detection Server"
+)
+
+const serviceUsage = `Usage:
+  server service install [server flags]   e.g. -config C:\ids\server.json -logfile C:\ids\server.log
+  server service uninstall
+
+Services start in C:\Windows\System32, so give absolute paths.`
+
+// isWindowsService reports whether the Service Control Manager started us
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// windowsService adapts run to the Service Control Manager
+type windowsService struct {
+	opts options
+}
+
+func (w *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, w.opts) }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Server error: %v", err)
+				return true, 1
+			}
+			log.Println("Server stopped")
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// runWindowsService runs the server under the Service Control Manager
+func runWindowsService(opts options) {
+	if err := svc.Run(serviceName, &windowsService{opts: opts}); err != nil {
+		log.Fatalf("Service failed: %v", err)
+	}
+}
+
+// runServiceCommand handles `server service install|uninstall`
+func runServiceCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, serviceUsage)
+		os.Exit(2)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		log.Fatalf("Failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	switch args[0] {
+	case "install":
+		exe, err := os.Executable()
+		if err != nil {
+			log.Fatalf("Failed to locate executable: %v", err)
+		}
+		exe, _ = filepath.Abs(exe)
+
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: serviceDisplayName,
+			Description: "gRPC intrusion detection pipeline with Redis-backed rate limiting",
+			StartType:   mgr.StartAutomatic,
+		}, args[1:]...)
+		if err != nil {
+			log.Fatalf("Failed to install service: %v", err)
+		}
+		defer s.Close()
+		s.SetRecoveryActions([]mgr.RecoveryAction{
+			{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		}, 86400)
+		fmt.Printf("Installed service %s; start it with: sc start %s\n", serviceName, serviceName)
+
+	case "uninstall":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			log.Fatalf("Service %s is not installed: %v", serviceName, err)
+		}
+		defer s.Close()
+		if err := s.Delete(); err != nil {
+			log.Fatalf("Failed to remove service: %v", err)
+		}
+		fmt.Printf("Removed service %s\n", serviceName)
+
+	default:
+		fmt.Fprintln(os.Stderr, serviceUsage)
+		os.Exit(2)
+	}
+}
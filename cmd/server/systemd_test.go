@@ -0,0 +1,102 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotify points NOTIFY_SOCKET at a fresh datagram socket, standing in
+// for systemd
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// readNotify returns the next state sent to conn
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read notify socket: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotify(t)
+
+	sdNotify("READY=1")
+	if got := readNotify(t, conn); got != "READY=1" {
+		t.Errorf("got %q, want READY=1", got)
+	}
+
+	// Outside systemd it does nothing
+	t.Setenv("NOTIFY_SOCKET", "")
+	sdNotify("STOPPING=1")
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 256)); err == nil {
+		t.Errorf("got %d bytes without NOTIFY_SOCKET", n)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 15 * time.Second},
+		{"30000000", self, 15 * time.Second},
+		{"30000000", "1", 0}, // Meant for another process
+		{"0", "", 0},
+		{"soon", "", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := watchdogInterval(); got != tt.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: got %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runWatchdog(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		if got := readNotify(t, conn); got != "WATCHDOG=1" {
+			t.Fatalf("ping %d = %q, want WATCHDOG=1", i, got)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runWatchdog did not stop after cancel")
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Inspection rule names reported in Violation.Rule
+const (
+	RuleInvalidIP       = "invalid_ip"
+	RulePayloadTooLarge = "payload_too_large"
+	RuleClockSkew       = "clock_skew"
+	RuleDenyPattern     = "deny_pattern"
+)
+
+// Rules configures payload inspection. Zero values disable the matching check.
+type Rules struct {
+	MaxPayloadSize int           // Largest accepted payload in bytes
+	MaxClockSkew   time.Duration // Largest accepted distance between request timestamp and now
+	DenyPatterns   [][]byte      // Byte sequences that must not appear in a payload
+}
+
+// DefaultRules returns the inspection rules the server applies out of the box
+func DefaultRules() Rules {
+	return Rules{
+		MaxPayloadSize: 64 * 1024,
+		MaxClockSkew:   5 * time.Minute,
+	}
+}
+
+// Violation describes the inspection rule a request broke
+type Violation struct {
+	Rule   string
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Detail)
+}
+
+// Inspect checks a request against the rules and returns the first violation, or nil.
+// timestamp is in Unix nanoseconds, matching LogRequest.
+func (r Rules) Inspect(ip string, payload []byte, timestamp int64, now time.Time) *Violation {
+	if net.ParseIP(ip) == nil {
+		return &Violation{Rule: RuleInvalidIP, Detail: fmt.Sprintf("%q is not an IP address", ip)}
+	}
+
+	if r.MaxPayloadSize > 0 && len(payload) > r.MaxPayloadSize {
+		return &Violation{
+			Rule:   RulePayloadTooLarge,
+			Detail: fmt.Sprintf("payload is %d bytes, limit is %d", len(payload), r.MaxPayloadSize),
+		}
+	}
+
+	if r.MaxClockSkew > 0 {
+		skew := now.Sub(time.Unix(0, timestamp)).Abs()
+		if skew > r.MaxClockSkew {
+			return &Violation{
+				Rule:   RuleClockSkew,
+				Detail: fmt.Sprintf("timestamp is %v away from server time, limit is %v", skew, r.MaxClockSkew),
+			}
+		}
+	}
+
+	for i, pattern := range r.DenyPatterns {
+		if len(pattern) > 0 && bytes.Contains(payload, pattern) {
+			return &Violation{Rule: RuleDenyPattern, Detail: fmt.Sprintf("payload matches deny pattern #%d", i)}
+		}
+	}
+
+	return nil
+}
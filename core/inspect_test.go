@@ -0,0 +1,40 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func FuzzInspect(f *testing.F) {
+	now := time.Unix(1_700_000_000, 0)
+	f.Add("192.168.1.1", []byte("payload"), now.UnixNano())
+	f.Add("::1", []byte{}, int64(0))
+	f.Add("not-an-ip", []byte("attack"), int64(-1<<63))
+	f.Add("10.0.0.1", make([]byte, 70*1024), now.UnixNano())
+
+	rules := DefaultRules()
+	rules.DenyPatterns = [][]byte{[]byte("attack"), nil}
+
+	f.Fuzz(func(t *testing.T, ip string, payload []byte, timestamp int64) {
+		v := rules.Inspect(ip, payload, timestamp, now)
+		if v == nil {
+			if net.ParseIP(ip) == nil {
+				t.Fatalf("invalid IP %q accepted", ip)
+			}
+			if len(payload) > rules.MaxPayloadSize {
+				t.Fatalf("%d byte payload accepted", len(payload))
+			}
+			return
+		}
+
+		switch v.Rule {
+		case RuleInvalidIP, RulePayloadTooLarge, RuleClockSkew, RuleDenyPattern:
+		default:
+			t.Fatalf("unknown rule %q", v.Rule)
+		}
+		if v.Error() == "" {
+			t.Fatalf("empty violation message")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidLimit is returned when a limiter is asked for a non-positive limit or window
+var ErrInvalidLimit = errors.New("core: limit and window must be positive")
+
+// slidingWindowScript keeps one sorted-set member per admitted request, scored
+// by its millisecond timestamp. The member embeds the current count so two
+// requests in the same millisecond never collapse into one entry.
+var slidingWindowScript = redis.NewScript(`
+	local key = KEYS[1]
+	local now = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+	local clearBefore = now - window
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', clearBefore)
+	local count = redis.call('ZCARD', key)
+
+	if count < limit then
+		redis.call('ZADD', key, now, now .. '-' .. count .. '-' .. math.random(1000000))
+		redis.call('PEXPIRE', key, window)
+		return 1
+	else
+		return 0
+	end
+`)
+
+// Allow records a request for key at now and reports whether it fits within
+// limit requests per window. A request is only recorded when it is allowed.
+func Allow(ctx context.Context, rdb redis.Scripter, key string, now time.Time, window time.Duration, limit int) (bool, error) {
+	windowMs := window.Milliseconds()
+	if limit <= 0 || windowMs <= 0 {
+		return false, ErrInvalidLimit
+	}
+
+	result, err := slidingWindowScript.Run(ctx, rdb, []string{key}, now.UnixMilli(), windowMs, limit).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// Count returns how many requests for key are inside the window ending at now,
+// without recording anything. Entries that have expired are ignored, not removed.
+func Count(ctx context.Context, rdb redis.Cmdable, key string, now time.Time, window time.Duration) (int, error) {
+	windowMs := window.Milliseconds()
+	if windowMs <= 0 {
+		return 0, ErrInvalidLimit
+	}
+
+	// Same population the script's ZCARD sees after it clears old entries
+	clearBefore := now.UnixMilli() - windowMs
+	n, err := rdb.ZCount(ctx, key, fmt.Sprintf("(%d", clearBefore), "+inf").Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// reserveScript admits up to n requests at once, as slidingWindowScript
+// would one at a time, and returns how many it admitted
+var reserveScript = redis.NewScript(`
+	local key = KEYS[1]
+	local now = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	local granted = math.min(n, limit - count)
+	if granted <= 0 then
+		return 0
+	end
+	for i = 1, granted do
+		redis.call('ZADD', key, now, now .. '-' .. (count + i) .. '-' .. math.random(1000000))
+	end
+	redis.call('PEXPIRE', key, window)
+	return granted
+`)
+
+// releaseScript takes back up to n requests recorded at one millisecond
+var releaseScript = redis.NewScript(`
+	local members = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+	if #members == 0 then
+		return 0
+	end
+	return redis.call('ZREM', KEYS[1], unpack(members))
+`)
+
+// Reserve records up to n requests for key at now in one round trip and
+// returns how many fit within limit per window. Reserved requests that end
+// up unused should be handed back with Release.
+func Reserve(ctx context.Context, rdb redis.Scripter, key string, now time.Time, window time.Duration, limit, n int) (int, error) {
+	windowMs := window.Milliseconds()
+	if limit <= 0 || windowMs <= 0 || n <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	return reserveScript.Run(ctx, rdb, []string{key}, now.UnixMilli(), windowMs, limit, n).Int()
+}
+
+// Release removes n requests that Reserve recorded for key at reservedAt.
+// It returns how many were still in the window to remove.
+func Release(ctx context.Context, rdb redis.Scripter, key string, reservedAt time.Time, n int) (int, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	return releaseScript.Run(ctx, rdb, []string{key}, reservedAt.UnixMilli(), n).Int()
+}
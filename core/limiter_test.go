@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func FuzzAllow(f *testing.F) {
+	mr := miniredis.RunT(f)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	f.Cleanup(func() { rdb.Close() })
+
+	f.Add(uint8(3), uint16(100), []byte{0, 0, 0, 0, 10, 90, 1, 0})
+	f.Add(uint8(1), uint16(1), []byte{0, 1, 0, 1})
+	f.Add(uint8(0), uint16(0), []byte{5})
+
+	f.Fuzz(func(t *testing.T, limit uint8, windowMs uint16, steps []byte) {
+		mr.FlushAll()
+		ctx := context.Background()
+		window := time.Duration(windowMs) * time.Millisecond
+		now := time.UnixMilli(1_700_000_000_000)
+
+		// Each step advances the clock by that many milliseconds, then sends a request
+		var admitted []time.Time
+		for _, step := range steps {
+			now = now.Add(time.Duration(step) * time.Millisecond)
+
+			if limit == 0 || windowMs == 0 {
+				if _, err := Allow(ctx, rdb, "fuzz", now, window, int(limit)); err != ErrInvalidLimit {
+					t.Fatalf("limit=%d window=%v: got err %v, want ErrInvalidLimit", limit, window, err)
+				}
+				return
+			}
+
+			before, err := Count(ctx, rdb, "fuzz", now, window)
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			ok, err := Allow(ctx, rdb, "fuzz", now, window, int(limit))
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if ok != (before < int(limit)) {
+				t.Fatalf("Count reported %d of %d but Allow returned %v", before, limit, ok)
+			}
+			if !ok {
+				continue
+			}
+
+			admitted = append(admitted, now)
+			inWindow := 0
+			for _, at := range admitted {
+				if now.Sub(at) < window {
+					inWindow++
+				}
+			}
+			if inWindow > int(limit) {
+				t.Fatalf("%d requests admitted within %v, limit is %d", inWindow, window, limit)
+			}
+		}
+	})
+}
+
+func TestReserveAndRelease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	now := time.UnixMilli(1_700_000_000_000)
+
+	got, err := Reserve(ctx, rdb, "k", now, time.Second, 10, 4)
+	if err != nil || got != 4 {
+		t.Fatalf("Reserve(4) = %d, %v; want 4", got, err)
+	}
+	if got, err = Reserve(ctx, rdb, "k", now, time.Second, 10, 8); err != nil || got != 6 {
+		t.Fatalf("Reserve(8) near the limit = %d, %v; want 6", got, err)
+	}
+	if got, err = Reserve(ctx, rdb, "k", now, time.Second, 10, 1); err != nil || got != 0 {
+		t.Fatalf("Reserve at the limit = %d, %v; want 0", got, err)
+	}
+
+	if got, err = Release(ctx, rdb, "k", now, 3); err != nil || got != 3 {
+		t.Fatalf("Release(3) = %d, %v; want 3", got, err)
+	}
+	if n, err := Count(ctx, rdb, "k", now, time.Second); err != nil || n != 7 {
+		t.Fatalf("Count after release = %d, %v; want 7", n, err)
+	}
+	if ok, err := Allow(ctx, rdb, "k", now, time.Second, 10); err != nil || !ok {
+		t.Fatalf("Allow after release = %v, %v; want true", ok, err)
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxReplaySources caps how many source IPs are remembered per request digest
+const MaxReplaySources = 1000
+
+// replaySourcesScript adds an IP to the set of sources of one request digest
+// and returns {added, sources}. The set expires a window after the last sighting.
+var replaySourcesScript = redis.NewScript(`
+	local key = KEYS[1]
+	local ip = ARGV[1]
+	local window = tonumber(ARGV[2])
+	local cap = tonumber(ARGV[3])
+
+	local added = 0
+	if redis.call('SCARD', key) < cap then
+		added = redis.call('SADD', key, ip)
+	end
+	redis.call('PEXPIRE', key, window)
+	return {added, redis.call('SCARD', key)}
+`)
+
+// Digest identifies a signed request by its payload and signature. Because
+// the signature covers the timestamp, two requests only share a digest when
+// one is a byte-for-byte copy of the other.
+func Digest(payload []byte, signature string) string {
+	h := sha256.New()
+	h.Write(payload)
+	h.Write([]byte{0})
+	h.Write([]byte(signature))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// RecordSource notes that ip sent the request stored under key and returns
+// how many distinct IPs sent it within window. added is false when ip was
+// already counted.
+func RecordSource(ctx context.Context, rdb redis.Scripter, key, ip string, window time.Duration) (sources int, added bool, err error) {
+	windowMs := window.Milliseconds()
+	if windowMs <= 0 {
+		return 0, false, ErrInvalidLimit
+	}
+
+	result, err := replaySourcesScript.Run(ctx, rdb, []string{key}, ip, windowMs, MaxReplaySources).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return int(result[1]), result[0] == 1, nil
+}
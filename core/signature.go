@@ -0,0 +1,29 @@
+// Package core holds the request verification primitives shared by the
+// server and the traffic simulator: HMAC signatures, the Redis sliding-window
+// limiter and payload inspection rules.
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Sign returns the hex HMAC-SHA256 of payload followed by the big-endian timestamp
+func Sign(payload []byte, timestamp int64, secretKey string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write(payload)
+
+	tsBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(tsBytes, uint64(timestamp))
+	mac.Write(tsBytes)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature against payload and timestamp in constant time
+func VerifySignature(payload []byte, timestamp int64, signature string, secretKey string) bool {
+	expectedSig := Sign(payload, timestamp, secretKey)
+	return hmac.Equal([]byte(expectedSig), []byte(signature))
+}
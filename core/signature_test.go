@@ -0,0 +1,24 @@
+package core
+
+import "testing"
+
+func FuzzVerifySignature(f *testing.F) {
+	f.Add([]byte("hello"), int64(1700000000000000000), "my-super-secret-key", "")
+	f.Add([]byte{}, int64(0), "", "invalid-tampered-signature")
+	f.Add([]byte{0xff, 0x00}, int64(-1), "k", "00")
+
+	f.Fuzz(func(t *testing.T, payload []byte, timestamp int64, key string, signature string) {
+		valid := Sign(payload, timestamp, key)
+		if !VerifySignature(payload, timestamp, valid, key) {
+			t.Fatalf("signature from Sign rejected: payload=%x ts=%d", payload, timestamp)
+		}
+
+		if signature != valid && VerifySignature(payload, timestamp, signature, key) {
+			t.Fatalf("arbitrary signature %q accepted", signature)
+		}
+
+		if VerifySignature(payload, timestamp+1, valid, key) {
+			t.Fatalf("signature accepted for a different timestamp")
+		}
+	})
+}
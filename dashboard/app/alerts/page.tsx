@@ -0,0 +1,25 @@
+import Link from 'next/link'
+import AlertHistory from '@/components/AlertHistory'
+
+export default function AlertsPage() {
+  return (
+    <main className="min-h-screen p-6">
+      <div className="max-w-7xl mx-auto">
+        {/* Header */}
+        <header className="mb-8 flex items-end justify-between">
+          <div>
+            <h1 className="text-3xl font-bold tracking-tight">
+              <span className="text-cyan-400">IDS</span> Alerts
+            </h1>
+            <p className="text-gray-500 mt-2 text-sm">Alert history across the cluster</p>
+          </div>
+          <Link href="/" className="text-sm text-cyan-400 hover:text-cyan-300">
+            ← Live monitor
+          </Link>
+        </header>
+
+        <AlertHistory />
+      </div>
+    </main>
+  )
+}
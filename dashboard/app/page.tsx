@@ -1,3 +1,4 @@
+import Link from 'next/link'
 import LiveMonitor from '@/components/LiveMonitor'
 
 export default function Home() {
@@ -5,16 +6,21 @@ export default function Home() {
     <main className="min-h-screen p-6">
       <div className="max-w-7xl mx-auto">
         {/* Header */}
-        <header className="mb-8">
-          <div className="flex items-center gap-4">
-            <div className="w-3 h-3 bg-emerald-500 rounded-full animate-pulse"></div>
-            <h1 className="text-3xl font-bold tracking-tight">
-              <span className="text-cyan-400">IDS</span> Dashboard
-            </h1>
+        <header className="mb-8 flex items-end justify-between">
+          <div>
+            <div className="flex items-center gap-4">
+              <div className="w-3 h-3 bg-emerald-500 rounded-full animate-pulse"></div>
+              <h1 className="text-3xl font-bold tracking-tight">
+                <span className="text-cyan-400">IDS</span> Dashboard
+              </h1>
+            </div>
+            <p className="text-gray-500 mt-2 text-sm">
+              Real-time Intrusion Detection System Monitor
+            </p>
           </div>
-          <p className="text-gray-500 mt-2 text-sm">
-            Real-time Intrusion Detection System Monitor
-          </p>
+          <Link href="/alerts" className="text-sm text-cyan-400 hover:text-cyan-300">
+            Alert history →
+          </Link>
         </header>
 
         {/* Live Monitor Component */}
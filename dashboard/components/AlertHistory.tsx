@@ -0,0 +1,206 @@
+'use client'
+
+import { useCallback, useEffect, useState } from 'react'
+
+interface StoredAlert {
+  id: string
+  kind: string
+  severity: string
+  message: string
+  ip?: string
+  timestamp: number
+}
+
+interface AlertPage {
+  alerts: StoredAlert[]
+  next_cursor?: string
+}
+
+interface Filters {
+  since: string
+  severity: string
+  kind: string
+  ip: string
+}
+
+// Same server as the WebSocket feed
+const API_URL = process.env.NEXT_PUBLIC_API_URL ?? 'http://localhost:8080'
+const PAGE_SIZE = 50
+// The alert history needs the admin token; it is kept for the browser session only
+const TOKEN_KEY = 'ids-admin-token'
+
+const RANGES = [
+  { label: 'Last hour', value: '1h' },
+  { label: 'Last 24 hours', value: '24h' },
+  { label: 'Last 7 days', value: '168h' },
+  { label: 'All', value: '' },
+]
+
+export default function AlertHistory() {
+  const [filters, setFilters] = useState<Filters>({ since: '24h', severity: '', kind: '', ip: '' })
+  const [alerts, setAlerts] = useState<StoredAlert[]>([])
+  const [cursor, setCursor] = useState<string | undefined>()
+  const [loading, setLoading] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+  const [token, setToken] = useState('')
+
+  useEffect(() => {
+    setToken(sessionStorage.getItem(TOKEN_KEY) ?? '')
+  }, [])
+
+  const saveToken = (value: string) => {
+    sessionStorage.setItem(TOKEN_KEY, value)
+    setToken(value)
+  }
+
+  const load = useCallback(
+    async (from?: string) => {
+      if (!token) {
+        setAlerts([])
+        setCursor(undefined)
+        setError('enter the admin token to browse alerts')
+        return
+      }
+      const params = new URLSearchParams({ limit: String(PAGE_SIZE) })
+      for (const [name, value] of Object.entries(filters)) {
+        if (value) params.set(name, value)
+      }
+      if (from) params.set('cursor', from)
+
+      setLoading(true)
+      setError(null)
+      try {
+        const res = await fetch(`${API_URL}/api/alerts?${params}`, {
+          headers: { Authorization: `Bearer ${token}` },
+        })
+        if (!res.ok) throw new Error(`${res.status}: ${(await res.text()).trim()}`)
+        const page: AlertPage = await res.json()
+        setAlerts((prev) => (from ? [...prev, ...page.alerts] : page.alerts))
+        setCursor(page.next_cursor)
+      } catch (e) {
+        setError(e instanceof Error ? e.message : String(e))
+      } finally {
+        setLoading(false)
+      }
+    },
+    [filters, token]
+  )
+
+  // Start over whenever the filters change
+  useEffect(() => {
+    load()
+  }, [load])
+
+  const inputClass =
+    'bg-gray-900 border border-gray-700 rounded-lg px-3 py-2 text-sm text-gray-200 focus:outline-none focus:border-cyan-600'
+
+  return (
+    <div className="space-y-6">
+      {/* Filters */}
+      <div className="bg-gray-900/50 rounded-xl p-4 border border-gray-800 flex flex-wrap gap-3">
+        <select
+          className={inputClass}
+          value={filters.since}
+          onChange={(e) => setFilters({ ...filters, since: e.target.value })}
+        >
+          {RANGES.map((r) => (
+            <option key={r.label} value={r.value}>
+              {r.label}
+            </option>
+          ))}
+        </select>
+        <select
+          className={inputClass}
+          value={filters.severity}
+          onChange={(e) => setFilters({ ...filters, severity: e.target.value })}
+        >
+          <option value="">Any severity</option>
+          <option value="critical">Critical</option>
+          <option value="warning,critical">Warning and up</option>
+          <option value="info">Info</option>
+        </select>
+        <input
+          className={inputClass}
+          placeholder="Kind, e.g. under_attack"
+          defaultValue={filters.kind}
+          onBlur={(e) => setFilters({ ...filters, kind: e.target.value.trim() })}
+        />
+        <input
+          className={inputClass}
+          placeholder="IP"
+          defaultValue={filters.ip}
+          onBlur={(e) => setFilters({ ...filters, ip: e.target.value.trim() })}
+        />
+        <input
+          className={inputClass}
+          type="password"
+          placeholder="Admin token"
+          defaultValue={token}
+          key={token ? 'token-set' : 'token-unset'}
+          onBlur={(e) => saveToken(e.target.value.trim())}
+        />
+      </div>
+
+      {error && (
+        <div className="bg-red-950/30 border border-red-900/50 rounded-lg px-4 py-2 text-sm text-red-400">
+          Failed to load alerts: {error}
+        </div>
+      )}
+
+      {/* Results */}
+      <div className="bg-gray-900/50 rounded-xl border border-gray-800 overflow-hidden">
+        <table className="w-full text-sm">
+          <thead className="text-gray-500 text-left border-b border-gray-800">
+            <tr>
+              <th className="px-4 py-3 font-medium">Time</th>
+              <th className="px-4 py-3 font-medium">Severity</th>
+              <th className="px-4 py-3 font-medium">Kind</th>
+              <th className="px-4 py-3 font-medium">IP</th>
+              <th className="px-4 py-3 font-medium">Message</th>
+            </tr>
+          </thead>
+          <tbody>
+            {alerts.map((alert) => (
+              <tr key={alert.id} className="border-b border-gray-800/50">
+                <td className="px-4 py-2 text-gray-400 whitespace-nowrap">
+                  {new Date(alert.timestamp * 1000).toLocaleString()}
+                </td>
+                <td
+                  className={`px-4 py-2 font-medium uppercase text-xs ${
+                    alert.severity === 'critical'
+                      ? 'text-red-400'
+                      : alert.severity === 'warning'
+                        ? 'text-amber-400'
+                        : 'text-gray-400'
+                  }`}
+                >
+                  {alert.severity}
+                </td>
+                <td className="px-4 py-2 text-gray-500 font-mono">{alert.kind}</td>
+                <td className="px-4 py-2 text-gray-300 font-mono">{alert.ip ?? '—'}</td>
+                <td className="px-4 py-2 text-gray-300">{alert.message}</td>
+              </tr>
+            ))}
+            {alerts.length === 0 && !loading && (
+              <tr>
+                <td colSpan={5} className="px-4 py-8 text-center text-gray-500">
+                  No alerts match these filters
+                </td>
+              </tr>
+            )}
+          </tbody>
+        </table>
+      </div>
+
+      {cursor && (
+        <button
+          className="px-4 py-2 rounded-lg bg-gray-800 hover:bg-gray-700 text-sm text-gray-200 disabled:opacity-50"
+          disabled={loading}
+          onClick={() => load(cursor)}
+        >
+          {loading ? 'Loading…' : 'Load more'}
+        </button>
+      )}
+    </div>
+  )
+}
@@ -23,32 +23,77 @@ interface Alert {
   id: number
   timestamp: string
   blocked: number
+  blockedBy: Record<string, number>
   rps: number
 }
 
+interface HistoryEntry {
+  status: string
+  payload_size: number
+  received_at: number
+  interval_ms: number
+}
+
 interface AIAlert {
   id: number
   timestamp: string
   ip: string
   payloadSize: number
+  history: HistoryEntry[]
 }
 
-const WS_URL = 'ws://localhost:8080/ws'
+interface SecurityAlert {
+  id: number
+  timestamp: string
+  kind: string
+  severity: string
+  message: string
+}
+
+interface GeoCount {
+  country?: string
+  asn?: number
+  org?: string
+  requests: number
+  blocked: number
+}
+
+interface GeoSnapshot {
+  window: string
+  countries: GeoCount[] | null
+  asns: GeoCount[] | null
+}
+
+// Use wss:// when the server has TLS enabled
+const WS_URL = process.env.NEXT_PUBLIC_WS_URL ?? 'ws://localhost:8080/ws'
 const MAX_DATA_POINTS = 60
 
+// Reason labels sent in blocked_by, as named in LogResponse.reason
+const REASON_LABELS: Record<string, string> = {
+  invalid_signature: 'Signature',
+  malformed: 'Malformed',
+  blocklist: 'Blocklist',
+  replay: 'Replay',
+  rate_limit: 'Rate limit',
+}
+
 export default function LiveMonitor() {
   const [data, setData] = useState<DataPoint[]>([])
   const [alerts, setAlerts] = useState<Alert[]>([])
   const [aiAlerts, setAiAlerts] = useState<AIAlert[]>([])
+  const [securityAlerts, setSecurityAlerts] = useState<SecurityAlert[]>([])
   const [connected, setConnected] = useState(false)
+  const [underAttack, setUnderAttack] = useState(false)
   const [currentRPS, setCurrentRPS] = useState(0)
   const [currentBlocked, setCurrentBlocked] = useState(0)
   const [totalRequests, setTotalRequests] = useState(0)
   const [totalBlocked, setTotalBlocked] = useState(0)
   const [totalAIAlerts, setTotalAIAlerts] = useState(0)
+  const [geo, setGeo] = useState<GeoSnapshot | null>(null)
   const wsRef = useRef<WebSocket | null>(null)
   const alertIdRef = useRef(0)
   const aiAlertIdRef = useRef(0)
+  const securityAlertIdRef = useRef(0)
 
   useEffect(() => {
     const connect = () => {
@@ -88,12 +133,37 @@ export default function LiveMonitor() {
               timestamp: timeStr,
               ip: payload.ip,
               payloadSize: payload.payload_size,
+              history: payload.history ?? [],
             }
             setAiAlerts((prev) => [newAIAlert, ...prev].slice(0, 50))
             setTotalAIAlerts((prev) => prev + 1)
             return
           }
 
+          // Alerts raised by server-side detectors
+          if (payload.type === 'alert') {
+            const newSecurityAlert: SecurityAlert = {
+              id: securityAlertIdRef.current++,
+              timestamp: timeStr,
+              kind: payload.kind,
+              severity: payload.severity,
+              message: payload.message,
+            }
+            setSecurityAlerts((prev) => [newSecurityAlert, ...prev].slice(0, 20))
+            return
+          }
+
+          // Traffic by country and ASN, sent every geo rollup
+          if (payload.type === 'geo') {
+            setGeo(payload)
+            return
+          }
+
+          // Ignore any other typed message this dashboard doesn't know about
+          if (payload.type) {
+            return
+          }
+
           // Regular stats payload
           const newPoint: DataPoint = {
             time: timeStr,
@@ -102,6 +172,7 @@ export default function LiveMonitor() {
             blocked: payload.blocked,
           }
 
+          setUnderAttack(payload.under_attack === true)
           setCurrentRPS(payload.rps)
           setCurrentBlocked(payload.blocked)
           setTotalRequests((prev) => prev + payload.rps)
@@ -117,6 +188,7 @@ export default function LiveMonitor() {
               id: alertIdRef.current++,
               timestamp: timeStr,
               blocked: payload.blocked,
+              blockedBy: payload.blocked_by ?? {},
               rps: payload.rps,
             }
             setAlerts((prev) => [newAlert, ...prev].slice(0, 20))
@@ -150,6 +222,15 @@ export default function LiveMonitor() {
         </span>
       </div>
 
+      {/* Under-Attack Banner */}
+      {underAttack && (
+        <div className="flex items-center gap-3 bg-red-950/50 border border-red-700 rounded-xl px-6 py-3 text-red-300">
+          <span className="w-3 h-3 bg-red-500 rounded-full pulse-alert"></span>
+          <span className="font-semibold">Under-attack mode active</span>
+          <span className="text-red-400/80 text-sm">Rate limits are tightened until traffic returns to normal</span>
+        </div>
+      )}
+
       {/* Stats Cards */}
       <div className="grid grid-cols-2 md:grid-cols-5 gap-4">
         <StatCard
@@ -242,17 +323,52 @@ export default function LiveMonitor() {
         </div>
       </div>
 
+      {/* Security Alerts */}
+      {securityAlerts.length > 0 && (
+        <div className="bg-gray-900/50 rounded-xl p-6 border border-amber-800/50">
+          <h2 className="text-lg font-semibold mb-4 text-gray-200 flex items-center gap-2">
+            <span className="w-2 h-2 bg-amber-500 rounded-full pulse-alert"></span>
+            Security Alerts
+          </h2>
+          <div className="max-h-48 overflow-y-auto space-y-2">
+            {securityAlerts.map((alert) => (
+              <div
+                key={alert.id}
+                className={`flex items-center justify-between rounded-lg px-4 py-2 text-sm border ${
+                  alert.severity === 'critical'
+                    ? 'bg-red-950/30 border-red-900/50'
+                    : 'bg-amber-950/30 border-amber-900/50'
+                }`}
+              >
+                <div className="flex items-center gap-3">
+                  <span className="text-gray-400">{alert.timestamp}</span>
+                  <span
+                    className={`font-medium uppercase text-xs ${
+                      alert.severity === 'critical' ? 'text-red-400' : 'text-amber-400'
+                    }`}
+                  >
+                    {alert.severity}
+                  </span>
+                  <span className="text-gray-300">{alert.message}</span>
+                </div>
+                <span className="text-gray-500 font-mono">{alert.kind}</span>
+              </div>
+            ))}
+          </div>
+        </div>
+      )}
+
       {/* Alerts Grid */}
       <div className="grid grid-cols-1 lg:grid-cols-2 gap-6">
-        {/* Rate Limit Alerts */}
+        {/* Blocks by reason */}
         <div className="bg-gray-900/50 rounded-xl p-6 border border-gray-800">
           <h2 className="text-lg font-semibold mb-4 text-gray-200 flex items-center gap-2">
             <span className="w-2 h-2 bg-red-500 rounded-full pulse-alert"></span>
-            Rate Limit Blocks
+            Blocks
           </h2>
           <div className="h-64 overflow-y-auto space-y-2">
             {alerts.length === 0 ? (
-              <p className="text-gray-500 text-sm">No rate limit blocks yet...</p>
+              <p className="text-gray-500 text-sm">No blocks yet...</p>
             ) : (
               alerts.map((alert) => (
                 <div
@@ -265,6 +381,11 @@ export default function LiveMonitor() {
                     <span className="text-red-400 font-medium">
                       {alert.blocked} blocked
                     </span>
+                    {Object.entries(alert.blockedBy).map(([reason, count]) => (
+                      <span key={reason} className="text-gray-500 text-xs">
+                        {REASON_LABELS[reason] ?? reason} {count}
+                      </span>
+                    ))}
                   </div>
                   <span className="text-gray-500">{alert.rps} req/s</span>
                 </div>
@@ -297,6 +418,12 @@ export default function LiveMonitor() {
                   </div>
                   <span className="text-gray-500">
                     {alert.payloadSize} bytes
+                    {alert.history.length > 0 && (
+                      <span className="ml-3 text-gray-600">
+                        last {alert.history.length}:{' '}
+                        {alert.history.filter((h) => h.status !== 'ALLOWED').length} blocked
+                      </span>
+                    )}
                   </span>
                 </div>
               ))
@@ -304,6 +431,74 @@ export default function LiveMonitor() {
           </div>
         </div>
       </div>
+
+      {/* Traffic by origin, only sent when the server has a GeoIP database */}
+      {geo && (
+        <div className="bg-gray-900/50 rounded-xl p-6 border border-gray-800">
+          <h2 className="text-lg font-semibold mb-4 text-gray-200">
+            Attack Origins <span className="text-gray-500 text-sm">(last {geo.window}, all servers)</span>
+          </h2>
+          <div className="grid grid-cols-1 lg:grid-cols-2 gap-6">
+            <GeoList
+              title="Countries"
+              counts={geo.countries ?? []}
+              label={(c) => `${countryFlag(c.country ?? '')} ${c.country}`}
+            />
+            <GeoList
+              title="Networks"
+              counts={geo.asns ?? []}
+              label={(c) => (c.asn ? `AS${c.asn} ${c.org ?? ''}` : 'Unknown')}
+            />
+          </div>
+        </div>
+      )}
+    </div>
+  )
+}
+
+// countryFlag turns an ISO country code into its flag emoji
+function countryFlag(code: string) {
+  if (!/^[A-Z]{2}$/.test(code)) {
+    return '🌐'
+  }
+  return String.fromCodePoint(...code.split('').map((c) => 0x1f1e6 + c.charCodeAt(0) - 65))
+}
+
+function GeoList({
+  title,
+  counts,
+  label,
+}: {
+  title: string
+  counts: GeoCount[]
+  label: (c: GeoCount) => string
+}) {
+  const max = Math.max(1, ...counts.map((c) => c.requests))
+
+  return (
+    <div>
+      <h3 className="text-sm text-gray-400 uppercase tracking-wider mb-2">{title}</h3>
+      {counts.length === 0 ? (
+        <p className="text-gray-500 text-sm">No traffic yet...</p>
+      ) : (
+        <div className="space-y-2">
+          {counts.map((c) => (
+            <div key={c.country ?? c.asn} className="text-sm">
+              <div className="flex justify-between text-gray-300">
+                <span className="truncate">{label(c)}</span>
+                <span className="text-gray-500">
+                  {c.requests.toLocaleString()}
+                  {c.blocked > 0 && <span className="text-red-400 ml-2">{c.blocked.toLocaleString()} blocked</span>}
+                </span>
+              </div>
+              <div className="h-1.5 bg-gray-800 rounded mt-1 flex overflow-hidden">
+                <div className="bg-red-500" style={{ width: `${(c.blocked / max) * 100}%` }}></div>
+                <div className="bg-cyan-500" style={{ width: `${((c.requests - c.blocked) / max) * 100}%` }}></div>
+              </div>
+            </div>
+          ))}
+        </div>
+      )}
     </div>
   )
 }
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.32.0
 // 	protoc        v3.12.4
 // source: proto/intrusion.proto
 
@@ -20,6 +20,121 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Decision is the machine-readable outcome of a request
+type Decision int32
+
+const (
+	Decision_DECISION_UNSPECIFIED Decision = 0
+	Decision_DECISION_ALLOWED     Decision = 1
+	Decision_DECISION_BLOCKED     Decision = 2
+	Decision_DECISION_THROTTLED   Decision = 3 // Retry after retry_after_ms
+	Decision_DECISION_CHALLENGE   Decision = 4 // Challenge the client before retrying
+)
+
+// Enum value maps for Decision.
+var (
+	Decision_name = map[int32]string{
+		0: "DECISION_UNSPECIFIED",
+		1: "DECISION_ALLOWED",
+		2: "DECISION_BLOCKED",
+		3: "DECISION_THROTTLED",
+		4: "DECISION_CHALLENGE",
+	}
+	Decision_value = map[string]int32{
+		"DECISION_UNSPECIFIED": 0,
+		"DECISION_ALLOWED":     1,
+		"DECISION_BLOCKED":     2,
+		"DECISION_THROTTLED":   3,
+		"DECISION_CHALLENGE":   4,
+	}
+)
+
+func (x Decision) Enum() *Decision {
+	p := new(Decision)
+	*p = x
+	return p
+}
+
+func (x Decision) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Decision) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_intrusion_proto_enumTypes[0].Descriptor()
+}
+
+func (Decision) Type() protoreflect.EnumType {
+	return &file_proto_intrusion_proto_enumTypes[0]
+}
+
+func (x Decision) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Decision.Descriptor instead.
+func (Decision) EnumDescriptor() ([]byte, []int) {
+	return file_proto_intrusion_proto_rawDescGZIP(), []int{0}
+}
+
+// Reason is the pipeline check behind a decision
+type Reason int32
+
+const (
+	Reason_REASON_NONE              Reason = 0
+	Reason_REASON_INVALID_SIGNATURE Reason = 1
+	Reason_REASON_MALFORMED         Reason = 2 // Payload inspection; rule names the inspection rule
+	Reason_REASON_BLOCKLIST         Reason = 3 // rule is the matching blocklist target
+	Reason_REASON_REPLAY            Reason = 4
+	Reason_REASON_RATE_LIMIT        Reason = 5
+)
+
+// Enum value maps for Reason.
+var (
+	Reason_name = map[int32]string{
+		0: "REASON_NONE",
+		1: "REASON_INVALID_SIGNATURE",
+		2: "REASON_MALFORMED",
+		3: "REASON_BLOCKLIST",
+		4: "REASON_REPLAY",
+		5: "REASON_RATE_LIMIT",
+	}
+	Reason_value = map[string]int32{
+		"REASON_NONE":              0,
+		"REASON_INVALID_SIGNATURE": 1,
+		"REASON_MALFORMED":         2,
+		"REASON_BLOCKLIST":         3,
+		"REASON_REPLAY":            4,
+		"REASON_RATE_LIMIT":        5,
+	}
+)
+
+func (x Reason) Enum() *Reason {
+	p := new(Reason)
+	*p = x
+	return p
+}
+
+func (x Reason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Reason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_intrusion_proto_enumTypes[1].Descriptor()
+}
+
+func (Reason) Type() protoreflect.EnumType {
+	return &file_proto_intrusion_proto_enumTypes[1]
+}
+
+func (x Reason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Reason.Descriptor instead.
+func (Reason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_intrusion_proto_rawDescGZIP(), []int{1}
+}
+
 // LogRequest represents incoming log data for analysis
 type LogRequest struct {
 	state         protoimpl.MessageState
@@ -98,8 +213,15 @@ type LogResponse struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Status  string `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`   // "ALLOWED", "BLOCKED_RATE_LIMIT", "BLOCKED_INVALID_SIG"
-	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"` // Human-readable explanation
+	Status       string   `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`                                    // "ALLOWED", "BLOCKED_RATE_LIMIT", "BLOCKED_INVALID_SIG"; kept for older agents, decision and reason carry the same
+	Message      string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`                                  // Human-readable explanation
+	Decision     Decision `protobuf:"varint,3,opt,name=decision,proto3,enum=intrusion.Decision" json:"decision,omitempty"`       // What the agent should do with the request
+	Reason       Reason   `protobuf:"varint,4,opt,name=reason,proto3,enum=intrusion.Reason" json:"reason,omitempty"`             // Check that matched; unset when none did
+	Rule         string   `protobuf:"bytes,5,opt,name=rule,proto3" json:"rule,omitempty"`                                        // Which rule of the check matched, e.g. "deny_pattern" or a blocklist target
+	Action       string   `protobuf:"bytes,6,opt,name=action,proto3" json:"action,omitempty"`                                    // Response action configured for the check, e.g. "block" or "tarpit"
+	RetryAfterMs int64    `protobuf:"varint,7,opt,name=retry_after_ms,json=retryAfterMs,proto3" json:"retry_after_ms,omitempty"` // Remaining ban or throttle time in milliseconds; 0 when unknown or allowed
+	Monitor      bool     `protobuf:"varint,8,opt,name=monitor,proto3" json:"monitor,omitempty"`                                 // Allowed only by monitor mode; reason and rule say what would have stopped it
+	DelayMs      int64    `protobuf:"varint,9,opt,name=delay_ms,json=delayMs,proto3" json:"delay_ms,omitempty"`                  // Tarpit: hold the answer to the client this long; the agent applies it per request
 }
 
 func (x *LogResponse) Reset() {
@@ -148,6 +270,55 @@ func (x *LogResponse) GetMessage() string {
 	return ""
 }
 
+func (x *LogResponse) GetDecision() Decision {
+	if x != nil {
+		return x.Decision
+	}
+	return Decision_DECISION_UNSPECIFIED
+}
+
+func (x *LogResponse) GetReason() Reason {
+	if x != nil {
+		return x.Reason
+	}
+	return Reason_REASON_NONE
+}
+
+func (x *LogResponse) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *LogResponse) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *LogResponse) GetRetryAfterMs() int64 {
+	if x != nil {
+		return x.RetryAfterMs
+	}
+	return 0
+}
+
+func (x *LogResponse) GetMonitor() bool {
+	if x != nil {
+		return x.Monitor
+	}
+	return false
+}
+
+func (x *LogResponse) GetDelayMs() int64 {
+	if x != nil {
+		return x.DelayMs
+	}
+	return 0
+}
+
 var File_proto_intrusion_proto protoreflect.FileDescriptor
 
 var file_proto_intrusion_proto_rawDesc = []byte{
@@ -161,20 +332,52 @@ var file_proto_intrusion_proto_rawDesc = []byte{
 	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74,
 	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x69, 0x67, 0x6e,
 	0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x69, 0x67,
-	0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x3f, 0x0a, 0x0b, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x18, 0x0a,
-	0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
-	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x32, 0x5c, 0x0a, 0x19, 0x49, 0x6e, 0x74, 0x72, 0x75,
-	0x73, 0x69, 0x6f, 0x6e, 0x44, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x72,
-	0x76, 0x69, 0x63, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4c, 0x6f,
-	0x67, 0x73, 0x12, 0x15, 0x2e, 0x69, 0x6e, 0x74, 0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x4c,
-	0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x69, 0x6e, 0x74, 0x72,
-	0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
-	0x65, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
-	0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x68, 0x61, 0x73, 0x68, 0x61, 0x6e, 0x6b, 0x2f, 0x69, 0x6e, 0x74,
-	0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x64, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x2f,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0xa2, 0x02, 0x0a, 0x0b, 0x4c, 0x6f, 0x67, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x18,
+	0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2f, 0x0a, 0x08, 0x64, 0x65, 0x63, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x69, 0x6e, 0x74,
+	0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x52,
+	0x08, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x29, 0x0a, 0x06, 0x72, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x69, 0x6e, 0x74, 0x72,
+	0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x52, 0x06, 0x72, 0x65,
+	0x61, 0x73, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x24, 0x0a, 0x0e, 0x72, 0x65, 0x74, 0x72, 0x79, 0x5f, 0x61, 0x66, 0x74, 0x65, 0x72, 0x5f,
+	0x6d, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x72, 0x65, 0x74, 0x72, 0x79, 0x41,
+	0x66, 0x74, 0x65, 0x72, 0x4d, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f,
+	0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72,
+	0x12, 0x19, 0x0a, 0x08, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x5f, 0x6d, 0x73, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x07, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x4d, 0x73, 0x2a, 0x80, 0x01, 0x0a, 0x08,
+	0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x14, 0x44, 0x45, 0x43, 0x49,
+	0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44,
+	0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x44, 0x45, 0x43, 0x49, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x41,
+	0x4c, 0x4c, 0x4f, 0x57, 0x45, 0x44, 0x10, 0x01, 0x12, 0x14, 0x0a, 0x10, 0x44, 0x45, 0x43, 0x49,
+	0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x42, 0x4c, 0x4f, 0x43, 0x4b, 0x45, 0x44, 0x10, 0x02, 0x12, 0x16,
+	0x0a, 0x12, 0x44, 0x45, 0x43, 0x49, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x54, 0x48, 0x52, 0x4f, 0x54,
+	0x54, 0x4c, 0x45, 0x44, 0x10, 0x03, 0x12, 0x16, 0x0a, 0x12, 0x44, 0x45, 0x43, 0x49, 0x53, 0x49,
+	0x4f, 0x4e, 0x5f, 0x43, 0x48, 0x41, 0x4c, 0x4c, 0x45, 0x4e, 0x47, 0x45, 0x10, 0x04, 0x2a, 0x8d,
+	0x01, 0x0a, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x0f, 0x0a, 0x0b, 0x52, 0x45, 0x41,
+	0x53, 0x4f, 0x4e, 0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x1c, 0x0a, 0x18, 0x52, 0x45,
+	0x41, 0x53, 0x4f, 0x4e, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x53, 0x49, 0x47,
+	0x4e, 0x41, 0x54, 0x55, 0x52, 0x45, 0x10, 0x01, 0x12, 0x14, 0x0a, 0x10, 0x52, 0x45, 0x41, 0x53,
+	0x4f, 0x4e, 0x5f, 0x4d, 0x41, 0x4c, 0x46, 0x4f, 0x52, 0x4d, 0x45, 0x44, 0x10, 0x02, 0x12, 0x14,
+	0x0a, 0x10, 0x52, 0x45, 0x41, 0x53, 0x4f, 0x4e, 0x5f, 0x42, 0x4c, 0x4f, 0x43, 0x4b, 0x4c, 0x49,
+	0x53, 0x54, 0x10, 0x03, 0x12, 0x11, 0x0a, 0x0d, 0x52, 0x45, 0x41, 0x53, 0x4f, 0x4e, 0x5f, 0x52,
+	0x45, 0x50, 0x4c, 0x41, 0x59, 0x10, 0x04, 0x12, 0x15, 0x0a, 0x11, 0x52, 0x45, 0x41, 0x53, 0x4f,
+	0x4e, 0x5f, 0x52, 0x41, 0x54, 0x45, 0x5f, 0x4c, 0x49, 0x4d, 0x49, 0x54, 0x10, 0x05, 0x32, 0x5c,
+	0x0a, 0x19, 0x49, 0x6e, 0x74, 0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x44, 0x65, 0x74, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x53,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x4c, 0x6f, 0x67, 0x73, 0x12, 0x15, 0x2e, 0x69, 0x6e, 0x74, 0x72,
+	0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x16, 0x2e, 0x69, 0x6e, 0x74, 0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x4c, 0x6f, 0x67,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2e, 0x5a, 0x2c,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x68, 0x61, 0x73, 0x68,
+	0x61, 0x6e, 0x6b, 0x2f, 0x69, 0x6e, 0x74, 0x72, 0x75, 0x73, 0x69, 0x6f, 0x6e, 0x64, 0x65, 0x74,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -189,19 +392,24 @@ func file_proto_intrusion_proto_rawDescGZIP() []byte {
 	return file_proto_intrusion_proto_rawDescData
 }
 
+var file_proto_intrusion_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
 var file_proto_intrusion_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_proto_intrusion_proto_goTypes = []interface{}{
-	(*LogRequest)(nil),  // 0: intrusion.LogRequest
-	(*LogResponse)(nil), // 1: intrusion.LogResponse
+	(Decision)(0),       // 0: intrusion.Decision
+	(Reason)(0),         // 1: intrusion.Reason
+	(*LogRequest)(nil),  // 2: intrusion.LogRequest
+	(*LogResponse)(nil), // 3: intrusion.LogResponse
 }
 var file_proto_intrusion_proto_depIdxs = []int32{
-	0, // 0: intrusion.IntrusionDetectionService.StreamLogs:input_type -> intrusion.LogRequest
-	1, // 1: intrusion.IntrusionDetectionService.StreamLogs:output_type -> intrusion.LogResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: intrusion.LogResponse.decision:type_name -> intrusion.Decision
+	1, // 1: intrusion.LogResponse.reason:type_name -> intrusion.Reason
+	2, // 2: intrusion.IntrusionDetectionService.StreamLogs:input_type -> intrusion.LogRequest
+	3, // 3: intrusion.IntrusionDetectionService.StreamLogs:output_type -> intrusion.LogResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_proto_intrusion_proto_init() }
@@ -240,13 +448,14 @@ func file_proto_intrusion_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_intrusion_proto_rawDesc,
-			NumEnums:      0,
+			NumEnums:      2,
 			NumMessages:   2,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_intrusion_proto_goTypes,
 		DependencyIndexes: file_proto_intrusion_proto_depIdxs,
+		EnumInfos:         file_proto_intrusion_proto_enumTypes,
 		MessageInfos:      file_proto_intrusion_proto_msgTypes,
 	}.Build()
 	File_proto_intrusion_proto = out.File
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// Pipeline checks that can be given a response action
+const (
+	CheckSignature  = "signature"
+	CheckInspection = "inspection"
+	CheckBlocklist  = "blocklist"
+	CheckReplay     = "replay"
+	CheckRateLimit  = "rate_limit"
+)
+
+var actionChecks = []string{CheckSignature, CheckInspection, CheckBlocklist, CheckReplay, CheckRateLimit}
+
+// Response actions
+const (
+	ActionAllow     = "allow"     // Let the request through
+	ActionAlert     = "alert"     // Let it through and raise an alert
+	ActionTarpit    = "tarpit"    // Block, telling the agent to hold the answer for Delay
+	ActionThrottle  = "throttle"  // Answer THROTTLED; the agent retries after Delay
+	ActionChallenge = "challenge" // Answer CHALLENGE; the agent challenges the client
+	ActionBlock     = "block"     // Answer BLOCKED with the check's reason (default)
+)
+
+const (
+	maxActionDelay    = 30 * time.Second
+	actionAlertPrefix = "action_alert:" // Limits alert-only findings to one per check, IP and minute
+)
+
+// ActionConfig is the response to a check that matched
+type ActionConfig struct {
+	Action string   `json:"action"`
+	Delay  Duration `json:"delay,omitempty"` // Tarpit hold time, or the retry hint for throttle
+}
+
+func (a ActionConfig) validate(check string) error {
+	switch a.Action {
+	case ActionAllow, ActionAlert, ActionChallenge, ActionBlock:
+	case ActionTarpit, ActionThrottle:
+		if a.Delay <= 0 || time.Duration(a.Delay) > maxActionDelay {
+			return fmt.Errorf("actions.%s: %s needs a delay between 0 and %v", check, a.Action, maxActionDelay)
+		}
+	default:
+		return fmt.Errorf("actions.%s: unknown action %q", check, a.Action)
+	}
+	return nil
+}
+
+func validateActions(actions map[string]ActionConfig) error {
+	for check, action := range actions {
+		if !slices.Contains(actionChecks, check) {
+			return fmt.Errorf("actions: unknown check %q, want one of %s", check, strings.Join(actionChecks, ", "))
+		}
+		if err := action.validate(check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finding is a pipeline check that matched a request
+type Finding struct {
+	Check      string
+	Rule       string // Which rule of the check matched, when it has several
+	Message    string
+	RetryAfter time.Duration // How long the IP stays blocked, if known
+}
+
+// Outcome is the response chosen for a request
+type Outcome struct {
+	Action     string
+	Status     string // Legacy form of Decision and Reason
+	Decision   pb.Decision
+	Reason     pb.Reason
+	Rule       string
+	Message    string
+	Delay      time.Duration // The agent holds the answer to the client this long
+	RetryAfter time.Duration // Remaining ban or throttle time told to the agent
+	Blocked    bool          // Counted as blocked; monitor mode lets it through
+}
+
+// outcome picks the configured action for f. A nil finding is allowed.
+func (c *Config) outcome(f *Finding) Outcome {
+	if f == nil {
+		return Outcome{
+			Action:   ActionAllow,
+			Status:   "ALLOWED",
+			Decision: pb.Decision_DECISION_ALLOWED,
+			Message:  "Request processed successfully",
+		}
+	}
+
+	action, ok := c.Actions[f.Check]
+	if !ok {
+		action = ActionConfig{Action: ActionBlock}
+	}
+	delay := time.Duration(action.Delay)
+
+	o := Outcome{
+		Action:     action.Action,
+		Reason:     checkReasons[f.Check],
+		Rule:       f.Rule,
+		Message:    f.Message,
+		RetryAfter: f.RetryAfter,
+		Blocked:    true,
+	}
+	switch action.Action {
+	case ActionAllow, ActionAlert:
+		o.Status, o.Decision, o.RetryAfter, o.Blocked = "ALLOWED", pb.Decision_DECISION_ALLOWED, 0, false
+		o.Message = fmt.Sprintf("Allowed by %s action: %s", f.Check, f.Message)
+	case ActionThrottle:
+		o.Status, o.Decision, o.RetryAfter = "THROTTLED", pb.Decision_DECISION_THROTTLED, delay
+		o.Message = fmt.Sprintf("%s; retry after %v", f.Message, delay)
+	case ActionChallenge:
+		o.Status, o.Decision = "CHALLENGE", pb.Decision_DECISION_CHALLENGE
+	case ActionTarpit:
+		o.Status, o.Decision, o.Delay = blockStatuses[o.Reason], pb.Decision_DECISION_BLOCKED, delay
+	default:
+		o.Action, o.Status, o.Decision = ActionBlock, blockStatuses[o.Reason], pb.Decision_DECISION_BLOCKED
+	}
+	return o
+}
+
+// response is the LogResponse for o. Monitor mode answers a blocking outcome
+// ALLOWED, keeping the reason and rule and naming the decision it replaced.
+func (o Outcome) response(monitor bool) *pb.LogResponse {
+	resp := &pb.LogResponse{
+		Status:       o.Status,
+		Message:      o.Message,
+		Decision:     o.Decision,
+		Reason:       o.Reason,
+		Rule:         o.Rule,
+		Action:       o.Action,
+		RetryAfterMs: o.RetryAfter.Milliseconds(),
+		DelayMs:      o.Delay.Milliseconds(),
+	}
+	if monitor && o.Blocked {
+		resp.Status, resp.Decision, resp.RetryAfterMs, resp.DelayMs, resp.Monitor = "ALLOWED", pb.Decision_DECISION_ALLOWED, 0, 0, true
+		resp.Message = fmt.Sprintf("Monitor mode: would be %s (%s)", o.Status, o.Message)
+	}
+	return resp
+}
+
+// alertFinding raises an alert for a finding whose action is alert-only, at
+// most once per check and IP each minute across all servers. In privacy mode
+// the message and rule don't name the IP.
+func (s *Server) alertFinding(ctx context.Context, ip string, f *Finding) {
+	key := fmt.Sprintf("%s%s:%s", actionAlertPrefix, f.Check, ip)
+	if first, err := s.rdb.SetNX(ctx, key, 1, time.Minute).Result(); err != nil || !first {
+		return
+	}
+
+	privacy := s.config().Privacy
+	message, rule := f.Message, f.Rule
+	if f.Check == CheckBlocklist && privacy.enabled() {
+		// The matched target is the IP itself or a range around it
+		message, rule = "IP is blocklisted", ""
+	}
+	message = strings.ReplaceAll(message, ip, privacy.Anonymize(ip))
+
+	s.raiseAlert(ctx, Alert{
+		Kind:     "finding",
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("%s check matched (alert-only): %s", f.Check, message),
+		IP:       ip,
+		Details:  map[string]any{"check": f.Check, "reason": reasonLabel(checkReasons[f.Check]), "rule": rule},
+	})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// RuntimePayload is returned by the admin runtime API
+type RuntimePayload struct {
+	Goroutines       int    `json:"goroutines"`
+	WebSocketClients int    `json:"websocket_clients"`
+	GRPCStreams      int64  `json:"grpc_streams"`
+	HeapAllocBytes   uint64 `json:"heap_alloc_bytes"`
+	NumGC            uint32 `json:"num_gc"`
+	UptimeSeconds    int64  `json:"uptime_seconds"`
+}
+
+var (
+	expvarOnce   sync.Once
+	expvarServer atomic.Pointer[Server]
+)
+
+// publishExpvar exposes the counters of the most recently created Server
+// under the "ids" expvar. expvar names are process-global, so it is only
+// registered once.
+func publishExpvar(s *Server) {
+	expvarServer.Store(s)
+	expvarOnce.Do(func() {
+		expvar.Publish("ids", expvar.Func(func() any {
+			s := expvarServer.Load()
+			vars := map[string]int64{
+				"total_requests":    s.stats.totalRequests.Load(),
+				"total_blocked":     s.stats.totalBlocked.Load(),
+				"active_streams":    s.stats.activeStreams.Load(),
+				"websocket_clients": int64(s.hub.Count()),
+				"allow_cache_hits":  s.allowCache.hits.Load(),
+				"allow_cache_calls": s.allowCache.reserved.Load(),
+				"lost_writes":       s.stats.lostWrites.Load(),
+			}
+			if s.queue != nil {
+				vars["queue_pending"] = s.queue.Len()
+				vars["queue_bytes"] = s.queue.Bytes()
+				vars["queue_dropped"] = s.queue.Dropped()
+			}
+			for reason := 1; reason < numReasons; reason++ {
+				vars["blocked_"+reasonLabel(pb.Reason(reason))] = s.stats.totalBlockedByReason[reason].Load()
+			}
+			return vars
+		}))
+	})
+}
+
+// requireAdmin rejects requests that don't carry the admin bearer token.
+// An empty token rejects everything.
+func requireAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON encodes v as the response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// runtimeHandler reports goroutine, connection and memory counts
+func (s *Server) runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	writeJSON(w, http.StatusOK, RuntimePayload{
+		Goroutines:       runtime.NumGoroutine(),
+		WebSocketClients: s.hub.Count(),
+		GRPCStreams:      s.stats.activeStreams.Load(),
+		HeapAllocBytes:   mem.HeapAlloc,
+		NumGC:            mem.NumGC,
+		UptimeSeconds:    int64(time.Since(s.startTime).Seconds()),
+	})
+}
+
+// AdminHandler serves pprof, expvar and the admin API behind bearer auth
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/api/runtime", s.runtimeHandler)
+	mux.HandleFunc("/api/policy", s.policyHandler)
+	mux.HandleFunc("/api/policy/evaluate", s.policyEvaluateHandler)
+	mux.HandleFunc("/api/blocklist", s.blocklistHandler)
+	mux.HandleFunc("/api/blocklist/export", s.blocklistExportHandler)
+	mux.HandleFunc("/api/blocklist/import", s.blocklistImportHandler)
+	mux.HandleFunc("/api/regions", s.regionsHandler)
+
+	mux.HandleFunc("/api/talkers", s.talkersHandler)
+	mux.HandleFunc("/api/streams", s.streamsHandler)
+	mux.HandleFunc("/api/cardinality", s.cardinalityHandler)
+	mux.HandleFunc("/api/baselines", s.baselinesHandler)
+	mux.HandleFunc("/api/geo", s.geoHandler)
+	mux.HandleFunc("/api/attack", s.attackHandler)
+	mux.HandleFunc("/api/events/export", s.eventsExportHandler)
+	mux.HandleFunc("/api/alerts", s.alertsHandler)
+	mux.HandleFunc("/api/canary", s.canaryHandler)
+	mux.HandleFunc("/api/mode", s.modeHandler)
+	mux.HandleFunc("/api/config/reload", s.reloadHandler)
+	mux.HandleFunc("/api/chaos", s.chaosHandler)
+
+	return s.securityHeaders(requireAdmin(s.config().AdminToken, mux))
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	alertsStreamKey      = "alerts"         // Redis stream of every alert raised in the cluster
+	aiAlertSeenPrefix    = "ai_alert_seen:" // Lets one server store each AI worker alert
+	alertsDefaultLimit   = 50
+	alertsMaxLimit       = 500
+	alertsScanBatch      = 500
+	alertsMaxScanBatches = 20 // A page that filters out this many batches returns early with a cursor
+)
+
+var streamIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// AlertHistoryConfig controls storing alerts so they can be browsed later
+type AlertHistoryConfig struct {
+	Enabled bool  `json:"enabled"`
+	MaxLen  int64 `json:"max_len"` // Approximate number of alerts kept
+}
+
+// DefaultAlertHistoryConfig returns the alert history settings used out of the box
+func DefaultAlertHistoryConfig() AlertHistoryConfig {
+	return AlertHistoryConfig{
+		Enabled: true,
+		MaxLen:  100000,
+	}
+}
+
+// StoredAlert is an alert read back from the history
+type StoredAlert struct {
+	ID string `json:"id"` // Stream ID, usable as a cursor
+	Alert
+}
+
+// AlertQuery selects stored alerts. Empty fields match everything.
+type AlertQuery struct {
+	Since, Until time.Time
+	Severities   []string
+	Kinds        []string
+	IP           string
+	Cursor       string // Return alerts older than this ID
+	Limit        int
+}
+
+func (q AlertQuery) matches(a Alert) bool {
+	if len(q.Severities) > 0 && !slices.Contains(q.Severities, a.Severity) {
+		return false
+	}
+	if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, a.Kind) {
+		return false
+	}
+	return q.IP == "" || q.IP == a.IP
+}
+
+// AlertPage is one page of GET /api/alerts, newest first
+type AlertPage struct {
+	Alerts     []StoredAlert `json:"alerts"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Pass as cursor for the next page; empty on the last one
+}
+
+// storeAlert appends an encoded alert to the history
+func (s *Server) storeAlert(ctx context.Context, data []byte) {
+	cfg := s.config().AlertHistory
+	if !cfg.Enabled {
+		return
+	}
+	err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: alertsStreamKey,
+		MaxLen: cfg.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"alert": data},
+	}).Err()
+	if err != nil {
+		log.Printf("Alert history error: %v (queued)", err)
+		s.spool(queueKindAlert, []json.RawMessage{data})
+	}
+}
+
+// storeAIAlert stores an AI worker alert. Every server receives it, so the
+// first to claim it writes it.
+func (s *Server) storeAIAlert(ctx context.Context, raw string, alert AIAlertPayload) {
+	if !s.config().AlertHistory.Enabled {
+		return
+	}
+	sum := sha256.Sum256([]byte(raw))
+	if first, err := s.rdb.SetNX(ctx, aiAlertSeenPrefix+hex.EncodeToString(sum[:16]), 1, time.Minute).Result(); err != nil || !first {
+		return
+	}
+
+	data, err := json.Marshal(Alert{
+		Type:      "alert",
+		Kind:      "ai_anomaly",
+		Severity:  SeverityWarning,
+		Message:   fmt.Sprintf("AI model flagged anomalous traffic (payload size %d)", alert.PayloadSize),
+		IP:        alert.IP,
+		Timestamp: alert.Timestamp,
+		Details:   map[string]any{"payload_size": alert.PayloadSize},
+	})
+	if err != nil {
+		return
+	}
+	s.storeAlert(ctx, data)
+}
+
+// QueryAlerts returns stored alerts matching q, newest first
+func QueryAlerts(ctx context.Context, rdb redis.Cmdable, q AlertQuery) (AlertPage, error) {
+	page := AlertPage{Alerts: []StoredAlert{}}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = alertsDefaultLimit
+	}
+
+	start, end := "-", "+"
+	if !q.Since.IsZero() {
+		start = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+	if !q.Until.IsZero() {
+		end = strconv.FormatInt(q.Until.UnixMilli(), 10)
+	}
+	if q.Cursor != "" {
+		end = "(" + q.Cursor
+	}
+
+	for batch := 0; batch < alertsMaxScanBatches; batch++ {
+		msgs, err := rdb.XRevRangeN(ctx, alertsStreamKey, end, start, alertsScanBatch).Result()
+		if err != nil {
+			return page, err
+		}
+		for _, msg := range msgs {
+			var stored StoredAlert
+			data, _ := msg.Values["alert"].(string)
+			if err := json.Unmarshal([]byte(data), &stored.Alert); err != nil {
+				log.Printf("Alert history: skipping %s: %v", msg.ID, err)
+				continue
+			}
+			if !q.matches(stored.Alert) {
+				continue
+			}
+			stored.ID = msg.ID
+			page.Alerts = append(page.Alerts, stored)
+			if len(page.Alerts) == limit {
+				page.NextCursor = msg.ID
+				return page, nil
+			}
+		}
+		if len(msgs) < alertsScanBatch {
+			return page, nil
+		}
+		end = "(" + msgs[len(msgs)-1].ID
+	}
+
+	// Scanned enough for one request; the caller continues from here
+	page.NextCursor = strings.TrimPrefix(end, "(")
+	return page, nil
+}
+
+// splitList reads a comma-separated query parameter
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// alertsHandler serves GET /api/alerts?since=&until=&severity=&kind=&ip=&cursor=&limit=
+func (s *Server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	now := time.Now()
+	var q AlertQuery
+	var err error
+	if q.Since, err = ParseTime(params.Get("since"), now); err != nil {
+		http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = ParseTime(params.Get("until"), now); err != nil {
+		http.Error(w, "until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > alertsMaxLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", alertsMaxLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Cursor = params.Get("cursor"); q.Cursor != "" && !streamIDPattern.MatchString(q.Cursor) {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	q.Severities = splitList(params.Get("severity"))
+	for _, severity := range q.Severities {
+		if _, ok := severityRank[severity]; !ok {
+			http.Error(w, fmt.Sprintf("unknown severity %q", severity), http.StatusBadRequest)
+			return
+		}
+	}
+	q.Kinds = splitList(params.Get("kind"))
+
+	// Stored IPs may be anonymized; accept either form
+	if q.IP = params.Get("ip"); q.IP != "" && !strings.HasPrefix(q.IP, "anon-") {
+		q.IP = s.config().Privacy.Anonymize(q.IP)
+	}
+
+	page, err := QueryAlerts(r.Context(), s.rdb, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	alertsCh         = "ids_alerts" // Redis Pub/Sub channel for server-raised alerts
+	alertSinkTimeout = 5 * time.Second
+)
+
+// Alert severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// Alert sink types
+const (
+	SinkWebhook = "webhook" // POSTs the alert as JSON
+	SinkSlack   = "slack"   // POSTs {"text": ...} to a Slack incoming webhook
+)
+
+// AlertSink forwards alerts raised by this server to an external system
+type AlertSink struct {
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	MinSeverity string `json:"min_severity"` // Lowest severity forwarded, default warning
+}
+
+func (k AlertSink) validate() error {
+	if k.Type != SinkWebhook && k.Type != SinkSlack {
+		return fmt.Errorf("alert sink type must be %q or %q", SinkWebhook, SinkSlack)
+	}
+	if k.URL == "" {
+		return fmt.Errorf("alert sink %s: url is required", k.Type)
+	}
+	if _, ok := severityRank[k.MinSeverity]; k.MinSeverity != "" && !ok {
+		return fmt.Errorf("alert sink %s: unknown min_severity %q", k.URL, k.MinSeverity)
+	}
+	return nil
+}
+
+func (k AlertSink) accepts(severity string) bool {
+	min := k.MinSeverity
+	if min == "" {
+		min = SeverityWarning
+	}
+	return severityRank[severity] >= severityRank[min]
+}
+
+// send delivers one alert. data is the alert's JSON encoding.
+func (k AlertSink) send(ctx context.Context, alert Alert, data []byte) error {
+	if k.Type == SinkSlack {
+		text := fmt.Sprintf("[%s] %s: %s", alert.Severity, alert.Kind, alert.Message)
+		data, _ = json.Marshal(map[string]string{"text": text})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", k.URL, resp.Status)
+	}
+	return nil
+}
+
+// Alert is raised by a server-side detector and delivered to the dashboard
+// of every server through Redis
+type Alert struct {
+	Type      string         `json:"type"` // Always "alert" on the wire
+	Kind      string         `json:"kind"` // Detector that raised it, e.g. "cardinality_spike"
+	Severity  string         `json:"severity"`
+	Message   string         `json:"message"`
+	IP        string         `json:"ip,omitempty"`
+	Timestamp int64          `json:"timestamp"` // Unix seconds
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// raiseAlert publishes alert to every server. If Redis is unavailable the
+// alert still reaches this server's dashboard clients.
+func (s *Server) raiseAlert(ctx context.Context, alert Alert) {
+	alert.Type = "alert"
+	alert.IP = s.config().Privacy.Anonymize(alert.IP)
+	if alert.Timestamp == 0 {
+		alert.Timestamp = time.Now().Unix()
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("Alert encode error: %v", err)
+		return
+	}
+
+	log.Printf("Alert [%s] %s: %s", alert.Severity, alert.Kind, alert.Message)
+	if err := s.rdb.Publish(ctx, alertsCh, data).Err(); err != nil {
+		log.Printf("Alert publish error: %v (broadcasting locally)", err)
+		s.hub.BroadcastRaw(data)
+	}
+	s.storeAlert(ctx, data)
+	s.notifySinks(alert, data)
+}
+
+// notifySinks forwards alert to the configured sinks in the background
+func (s *Server) notifySinks(alert Alert, data []byte) {
+	for _, sink := range s.config().AlertSinks {
+		if !sink.accepts(alert.Severity) {
+			continue
+		}
+		sink := sink
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), alertSinkTimeout)
+			defer cancel()
+			if err := sink.send(ctx, alert, data); err != nil {
+				log.Printf("Alert sink %s error: %v", sink.Type, err)
+			}
+		}()
+	}
+}
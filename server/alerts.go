@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// AIAlertPayload wraps AI worker alerts for dashboard
+type AIAlertPayload struct {
+	Type        string         `json:"type"`
+	IP          string         `json:"ip"`
+	PayloadSize int            `json:"payload_size"`
+	Timestamp   int64          `json:"timestamp"`
+	History     []HistoryEntry `json:"history,omitempty"` // Recent requests from IP, oldest first
+}
+
+// startAlertSubscriber listens for AI worker alerts and alerts raised by any
+// server, and forwards them to WebSocket
+func (s *Server) startAlertSubscriber(ctx context.Context) {
+	pubsub := s.rdb.Subscribe(ctx, aiAlertsCh, alertsCh)
+	defer pubsub.Close()
+
+	log.Printf("Subscribed to alert channels: %s, %s", aiAlertsCh, alertsCh)
+
+	// Closing the subscription ends the range loop below
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+
+	ch := pubsub.Channel()
+	for msg := range ch {
+		// Server alerts are already in dashboard form
+		if msg.Channel == alertsCh {
+			s.hub.BroadcastRaw([]byte(msg.Payload))
+			continue
+		}
+
+		// An injected delay stands in for an AI worker falling behind
+		if sleepContext(ctx, time.Duration(s.chaos.Active().AIWorkerDelay)) != nil {
+			return
+		}
+
+		// Parse and re-wrap with explicit type for dashboard
+		var alert AIAlertPayload
+		if err := json.Unmarshal([]byte(msg.Payload), &alert); err != nil {
+			log.Printf("AI alert parse error: %v", err)
+			continue
+		}
+		alert.Type = "ai_alert"
+		alert.History = s.history.Recent(alert.IP)
+		alert.IP = s.config().Privacy.Anonymize(alert.IP)
+		s.storeAIAlert(ctx, msg.Payload, alert)
+
+		data, err := json.Marshal(alert)
+		if err != nil {
+			continue
+		}
+
+		s.hub.BroadcastRaw(data)
+		log.Printf("AI Alert forwarded: IP=%s, PayloadSize=%d, History=%d", alert.IP, alert.PayloadSize, len(alert.History))
+	}
+}
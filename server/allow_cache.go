@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+)
+
+const (
+	maxAllowLeases    = 100_000 // IPs beyond this go to Redis for every request
+	defaultAllowSlice = 100 * time.Millisecond
+)
+
+// AllowCacheConfig lets busy IPs spend their rate limit locally in small
+// batches instead of one Redis call per request
+type AllowCacheConfig struct {
+	Enabled bool     `json:"enabled"`
+	Slice   Duration `json:"slice"` // How long a batch may be spent; unused requests are handed back after
+	Batch   int      `json:"batch"` // Requests reserved at once for an IP that used up its last batch
+}
+
+// DefaultAllowCacheConfig returns the allow cache settings used out of the box
+func DefaultAllowCacheConfig() AllowCacheConfig {
+	return AllowCacheConfig{
+		Enabled: false,
+		Slice:   Duration(defaultAllowSlice),
+		Batch:   10,
+	}
+}
+
+func (c AllowCacheConfig) validate() error {
+	if c.Enabled && (c.Slice <= 0 || time.Duration(c.Slice) > time.Second || c.Batch < 2) {
+		return errors.New("allow_cache slice must be in (0, 1s] and batch at least 2")
+	}
+	return nil
+}
+
+// allowLease is a batch of requests already recorded in Redis for one IP
+type allowLease struct {
+	key        string
+	reservedAt time.Time
+	expires    time.Time
+	remaining  int
+	exhausted  bool // Ran out before it expired, so the IP is busy
+}
+
+// AllowCache holds the leases of IPs sending more than one request per slice
+type AllowCache struct {
+	mu       sync.Mutex
+	leases   map[string]*allowLease
+	released []*allowLease // Replaced before the reaper got to them
+
+	hits     atomic.Int64 // Requests admitted without Redis
+	reserved atomic.Int64 // Redis calls made instead
+}
+
+// NewAllowCache returns an empty cache
+func NewAllowCache() *AllowCache {
+	return &AllowCache{leases: make(map[string]*allowLease)}
+}
+
+// Take admits a request for ip from its lease. busy reports that the IP used
+// up a recent lease and deserves a batch next time.
+func (c *AllowCache) Take(ip string, now time.Time) (hit, busy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lease, ok := c.leases[ip]
+	if !ok {
+		return false, false
+	}
+	if now.Before(lease.expires) {
+		if lease.remaining > 0 {
+			lease.remaining--
+			c.hits.Add(1)
+			return true, false
+		}
+		lease.exhausted = true
+		return false, true
+	}
+	return false, lease.exhausted
+}
+
+// Put stores a lease of remaining requests reserved at now
+func (c *AllowCache) Put(ip, key string, now time.Time, remaining int, slice time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, ok := c.leases[ip]
+	if !ok && len(c.leases) >= maxAllowLeases {
+		if remaining > 0 {
+			c.released = append(c.released, &allowLease{key: key, reservedAt: now, remaining: remaining})
+		}
+		return
+	}
+	if ok && old.remaining > 0 {
+		c.released = append(c.released, old)
+	}
+	c.leases[ip] = &allowLease{key: key, reservedAt: now, expires: now.Add(slice), remaining: remaining}
+}
+
+// expire removes leases that ran out of time and returns the ones with
+// requests to hand back
+func (c *AllowCache) expire(now time.Time) []*allowLease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unused := c.released
+	c.released = nil
+	for ip, lease := range c.leases {
+		if now.Before(lease.expires) {
+			continue
+		}
+		delete(c.leases, ip)
+		if lease.remaining > 0 {
+			unused = append(unused, lease)
+		}
+	}
+	return unused
+}
+
+// startAllowCache hands unused requests back to Redis once their slice is
+// over, so the shared count matches what was actually admitted
+func (s *Server) startAllowCache(ctx context.Context) {
+	for {
+		slice := time.Duration(s.config().AllowCache.Slice)
+		if slice <= 0 {
+			slice = defaultAllowSlice
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(slice):
+		}
+
+		for _, lease := range s.allowCache.expire(time.Now()) {
+			if _, err := core.Release(ctx, s.rdb, lease.key, lease.reservedAt, lease.remaining); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Allow cache release error: %v", err)
+				}
+				break
+			}
+		}
+	}
+}
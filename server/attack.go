@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+)
+
+const (
+	rpsSmoothing     = 0.01 // EWMA weight of each second in the RPS baseline
+	rpsWarmupSeconds = 60   // Seconds of baseline learned before RPS spikes count
+)
+
+// Under-attack overrides set through the admin API
+const (
+	AttackOverrideAuto = "auto" // Follow the detector
+	AttackOverrideOn   = "on"   // Stay under attack until set back to auto
+	AttackOverrideOff  = "off"  // Never enter under-attack mode
+)
+
+// AttackConfig controls automatic under-attack mode. The server enters it
+// when enough global signals hold for ActivateAfter and leaves it once all
+// of them have been clear for DeactivateAfter.
+type AttackConfig struct {
+	Enabled         bool     `json:"enabled"`
+	RPSFactor       float64  `json:"rps_factor"`       // RPS above RPSFactor × baseline is a spike
+	MinRPS          int64    `json:"min_rps"`          // RPS and block ratio signals need at least this much traffic
+	BlockRatio      float64  `json:"block_ratio"`      // Share of requests blocked that counts as a signal
+	MinSignals      int      `json:"min_signals"`      // Signals that must hold at once to activate
+	ActivateAfter   Duration `json:"activate_after"`   // How long the signals must hold
+	DeactivateAfter Duration `json:"deactivate_after"` // How long every signal must be clear
+
+	// Applied while under attack
+	RateLimitFactor float64  `json:"rate_limit_factor"` // Multiplies rate_limit
+	LocalBlockTTL   Duration `json:"local_block_ttl"`   // Replaces local_block_ttl when longer
+	MaxClockSkew    Duration `json:"max_clock_skew"`    // Replaces inspection.max_clock_skew when shorter
+
+	Actions map[string]ActionConfig `json:"actions"` // Override the response to these checks
+}
+
+// DefaultAttackConfig returns the under-attack settings used out of the box
+func DefaultAttackConfig() AttackConfig {
+	return AttackConfig{
+		Enabled:         true,
+		RPSFactor:       5,
+		MinRPS:          100,
+		BlockRatio:      0.5,
+		MinSignals:      2,
+		ActivateAfter:   Duration(30 * time.Second),
+		DeactivateAfter: Duration(5 * time.Minute),
+		RateLimitFactor: 0.5,
+		LocalBlockTTL:   Duration(5 * time.Minute),
+		MaxClockSkew:    Duration(30 * time.Second),
+	}
+}
+
+// underAttack returns a copy of c with the under-attack limits applied
+func (c Config) underAttack() Config {
+	a := c.UnderAttack
+	c.RateLimit = int(math.Max(1, math.Floor(float64(c.RateLimit)*a.RateLimitFactor)))
+	if a.LocalBlockTTL > c.LocalBlockTTL {
+		c.LocalBlockTTL = a.LocalBlockTTL
+	}
+	if a.MaxClockSkew > 0 && (c.Inspection.MaxClockSkew <= 0 || a.MaxClockSkew < c.Inspection.MaxClockSkew) {
+		c.Inspection.MaxClockSkew = a.MaxClockSkew
+	}
+	if len(a.Actions) > 0 {
+		actions := make(map[string]ActionConfig, len(c.Actions)+len(a.Actions))
+		for check, action := range c.Actions {
+			actions[check] = action
+		}
+		for check, action := range a.Actions {
+			actions[check] = action
+		}
+		c.Actions = actions
+	}
+	return c
+}
+
+// AttackSignals are the global signals the detector combines
+type AttackSignals struct {
+	RPSSpike      bool `json:"rps_spike"`
+	UniqueIPSpike bool `json:"unique_ip_spike"`
+	BlockRatio    bool `json:"block_ratio"`
+}
+
+func (a AttackSignals) count() int {
+	n := 0
+	for _, on := range []bool{a.RPSSpike, a.UniqueIPSpike, a.BlockRatio} {
+		if on {
+			n++
+		}
+	}
+	return n
+}
+
+func (a AttackSignals) String() string {
+	var names []string
+	if a.RPSSpike {
+		names = append(names, "RPS spike")
+	}
+	if a.UniqueIPSpike {
+		names = append(names, "unique-IP spike")
+	}
+	if a.BlockRatio {
+		names = append(names, "high block ratio")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// AttackStatus is returned by GET /api/attack
+type AttackStatus struct {
+	Active      bool          `json:"active"`
+	Override    string        `json:"override"`
+	Since       int64         `json:"since,omitempty"` // Unix seconds of the last change to Active
+	Signals     AttackSignals `json:"signals"`
+	RPS         int64         `json:"rps"`
+	BaselineRPS float64       `json:"baseline_rps"`
+	BlockRatio  float64       `json:"block_ratio"`
+}
+
+// AttackDetector turns per-second traffic into the under-attack state
+type AttackDetector struct {
+	active atomic.Bool // Effective state, read on every request
+
+	mu           sync.Mutex
+	override     string
+	auto         bool      // State chosen by the detector
+	pendingSince time.Time // When the condition to flip auto first held
+	since        time.Time
+	baseline     float64
+	learned      int
+	last         AttackStatus
+}
+
+// NewAttackDetector returns a detector in the calm state
+func NewAttackDetector() *AttackDetector {
+	return &AttackDetector{override: AttackOverrideAuto}
+}
+
+// Active reports whether under-attack limits apply
+func (d *AttackDetector) Active() bool {
+	return d.active.Load()
+}
+
+// observe folds in one second of traffic and reports whether the effective
+// state changed
+func (d *AttackDetector) observe(cfg AttackConfig, rps, blocked int64, uniqueIPSpike bool, now time.Time) (bool, AttackStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ratio := 0.0
+	if rps > 0 {
+		ratio = float64(blocked) / float64(rps)
+	}
+	signals := AttackSignals{
+		RPSSpike:      d.learned >= rpsWarmupSeconds && rps >= cfg.MinRPS && float64(rps) > cfg.RPSFactor*d.baseline,
+		UniqueIPSpike: uniqueIPSpike,
+		BlockRatio:    rps >= cfg.MinRPS && ratio >= cfg.BlockRatio,
+	}
+
+	// Learn from calm seconds only so an attack doesn't raise the baseline
+	if !signals.RPSSpike && !d.auto {
+		if d.learned == 0 {
+			d.baseline = float64(rps)
+		} else {
+			d.baseline += rpsSmoothing * (float64(rps) - d.baseline)
+		}
+		d.learned++
+	}
+
+	// Entering needs MinSignals, leaving needs every signal clear, and
+	// either condition has to hold for a while so the state doesn't flap
+	flip, hold := signals.count() >= cfg.MinSignals, time.Duration(cfg.ActivateAfter)
+	if d.auto {
+		flip, hold = signals.count() == 0, time.Duration(cfg.DeactivateAfter)
+	}
+	switch {
+	case !cfg.Enabled:
+		d.auto = false
+		d.pendingSince = time.Time{}
+	case !flip:
+		d.pendingSince = time.Time{}
+	case d.pendingSince.IsZero():
+		d.pendingSince = now
+		fallthrough
+	default:
+		if now.Sub(d.pendingSince) >= hold {
+			d.auto = !d.auto
+			d.pendingSince = time.Time{}
+		}
+	}
+
+	d.last.Signals = signals
+	d.last.RPS = rps
+	d.last.BaselineRPS = d.baseline
+	d.last.BlockRatio = ratio
+	return d.apply(now)
+}
+
+// SetOverride pins the state on or off, or hands it back to the detector
+func (d *AttackDetector) SetOverride(override string, now time.Time) (bool, AttackStatus, error) {
+	switch override {
+	case AttackOverrideAuto, AttackOverrideOn, AttackOverrideOff:
+	default:
+		return false, AttackStatus{}, fmt.Errorf("override must be %q, %q or %q", AttackOverrideAuto, AttackOverrideOn, AttackOverrideOff)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.override = override
+	changed, status := d.apply(now)
+	return changed, status, nil
+}
+
+// Status returns the state and the signals from the last second
+func (d *AttackDetector) Status() AttackStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status()
+}
+
+// apply publishes the effective state. Callers hold d.mu.
+func (d *AttackDetector) apply(now time.Time) (bool, AttackStatus) {
+	active := d.auto
+	switch d.override {
+	case AttackOverrideOn:
+		active = true
+	case AttackOverrideOff:
+		active = false
+	}
+
+	changed := d.active.Swap(active) != active
+	if changed {
+		d.since = now
+	}
+	return changed, d.status()
+}
+
+func (d *AttackDetector) status() AttackStatus {
+	status := d.last
+	status.Active = d.active.Load()
+	status.Override = d.override
+	if !d.since.IsZero() {
+		status.Since = d.since.Unix()
+	}
+	return status
+}
+
+// enforced returns the config and inspection rules requests are checked
+// against, tightened while under attack
+func (s *Server) enforced() (*Config, *core.Rules) {
+	if s.attack.Active() {
+		return s.attackCfg.Load(), s.attackRules.Load()
+	}
+	return s.config(), s.rules.Load()
+}
+
+// evaluateAttack is called by the stats broadcaster with each second's counts
+func (s *Server) evaluateAttack(ctx context.Context, rps, blocked int64, now time.Time) {
+	changed, status := s.attack.observe(s.config().UnderAttack, rps, blocked, s.cardinality.RecentSpike(now), now)
+	if changed {
+		s.announceAttack(ctx, status, "signals: "+status.Signals.String())
+	}
+}
+
+// announceAttack logs a state change and raises the matching alert
+func (s *Server) announceAttack(ctx context.Context, status AttackStatus, cause string) {
+	cfg := s.attackCfg.Load()
+	details := map[string]any{
+		"override":     status.Override,
+		"signals":      status.Signals,
+		"rps":          status.RPS,
+		"baseline_rps": status.BaselineRPS,
+		"block_ratio":  status.BlockRatio,
+	}
+
+	if status.Active {
+		log.Printf("Under attack (%s): rate limit %d per %v", cause, cfg.RateLimit, time.Duration(cfg.RateLimitWindow))
+		s.raiseAlert(ctx, Alert{
+			Kind:     "under_attack",
+			Severity: SeverityCritical,
+			Message:  fmt.Sprintf("Under-attack mode on (%s): rate limit tightened to %d per %v", cause, cfg.RateLimit, time.Duration(cfg.RateLimitWindow)),
+			Details:  details,
+		})
+		return
+	}
+
+	log.Printf("Under-attack mode off (%s)", cause)
+	s.raiseAlert(ctx, Alert{
+		Kind:     "under_attack_cleared",
+		Severity: SeverityInfo,
+		Message:  fmt.Sprintf("Under-attack mode off (%s): normal limits restored", cause),
+		Details:  details,
+	})
+}
+
+// setAttackOverride applies a manual override and announces the change it causes
+func (s *Server) setAttackOverride(ctx context.Context, override string) (AttackStatus, error) {
+	changed, status, err := s.attack.SetOverride(override, time.Now())
+	if err != nil {
+		return AttackStatus{}, err
+	}
+	log.Printf("Under-attack override set to %s", override)
+	if changed {
+		s.announceAttack(ctx, status, "manual override "+override)
+	}
+	return status, nil
+}
+
+// AttackOverridePayload is the body of PUT /api/attack
+type AttackOverridePayload struct {
+	Override string `json:"override"`
+}
+
+// attackHandler serves GET and PUT /api/attack
+func (s *Server) attackHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.attack.Status())
+	case http.MethodPut, http.MethodPost:
+		var req AttackOverridePayload
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		status, err := s.setAttackOverride(r.Context(), req.Override)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttackDetectorHysteresis(t *testing.T) {
+	cfg := DefaultAttackConfig()
+	d := NewAttackDetector()
+	now := time.Unix(1700000000, 0)
+
+	tick := func(rps, blocked int64, uniqueSpike bool) bool {
+		now = now.Add(time.Second)
+		changed, _ := d.observe(cfg, rps, blocked, uniqueSpike, now)
+		return changed
+	}
+
+	// Learn a calm baseline
+	for i := 0; i < rpsWarmupSeconds; i++ {
+		tick(200, 0, false)
+	}
+
+	// One signal is not enough
+	for i := 0; i < 60; i++ {
+		tick(5000, 0, false)
+	}
+	if d.Active() {
+		t.Fatal("activated on a single signal")
+	}
+
+	// Two signals must hold for ActivateAfter
+	hold := int(time.Duration(cfg.ActivateAfter) / time.Second)
+	for i := 0; i < hold; i++ {
+		if tick(5000, 4000, false) {
+			t.Fatalf("activated after %ds, want %ds", i, hold)
+		}
+	}
+	if !tick(5000, 4000, false) || !d.Active() {
+		t.Fatal("not active after signals held for activate_after")
+	}
+
+	// A lull shorter than DeactivateAfter, or one lingering signal, keeps it on
+	for i := 0; i < 60; i++ {
+		tick(200, 0, false)
+	}
+	tick(200, 0, true)
+	for i := 0; i < 60; i++ {
+		tick(200, 0, true)
+	}
+	if !d.Active() {
+		t.Fatal("deactivated while signals were flapping")
+	}
+
+	// Every signal clear for DeactivateAfter turns it off
+	calm := int(time.Duration(cfg.DeactivateAfter) / time.Second)
+	for i := 0; i <= calm; i++ {
+		tick(200, 0, false)
+	}
+	if d.Active() {
+		t.Fatal("still active after deactivate_after with no signals")
+	}
+	if status := d.Status(); status.BaselineRPS > 300 {
+		t.Errorf("baseline learned from the attack: %.0f", status.BaselineRPS)
+	}
+}
+
+func TestAttackDetectorOverride(t *testing.T) {
+	d := NewAttackDetector()
+	now := time.Now()
+
+	if changed, status, err := d.SetOverride(AttackOverrideOn, now); err != nil || !changed || !status.Active {
+		t.Fatalf("override on: changed=%v status=%+v err=%v", changed, status, err)
+	}
+
+	// The detector keeps running but can't turn a pinned state off
+	for i := 0; i < 600; i++ {
+		d.observe(DefaultAttackConfig(), 10, 0, false, now.Add(time.Duration(i)*time.Second))
+	}
+	if !d.Active() {
+		t.Fatal("override on was lifted by the detector")
+	}
+
+	if changed, _, _ := d.SetOverride(AttackOverrideAuto, now); !changed || d.Active() {
+		t.Fatal("returning to auto should restore the calm state")
+	}
+	if _, _, err := d.SetOverride("maybe", now); err == nil {
+		t.Fatal("accepted an unknown override")
+	}
+}
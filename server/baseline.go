@@ -0,0 +1,489 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	baselineKeyPrefix     = "baseline:"       // Hash of request counts and payload sizes per minute
+	baselineStateKey      = "baselines"       // JSON of the learned baselines
+	baselineAlertPrefix   = "baseline_alert:" // Limits alerts to one per metric per cooldown
+	baselineKeyTTL        = time.Hour
+	baselineStateTTL      = 30 * 24 * time.Hour
+	baselineFlushInterval = time.Second
+	payloadSizeBuckets    = 33 // Power-of-two buckets: 0, 1, 2-3, 4-7, ... 2^31 and up
+	payloadSizeQuantile   = 0.95
+	baselineHoursPerDay   = 24
+)
+
+// Baseline metrics, measured over each minute across all servers
+const (
+	MetricRPS             = "rps"
+	MetricBlockRatio      = "block_ratio"
+	MetricPayloadSizeMean = "payload_size_mean"
+	MetricPayloadSizeP95  = "payload_size_p95" // Approximate, from power-of-two buckets
+	MetricUniqueIPs       = "unique_ips"
+)
+
+var baselineMetrics = []string{MetricRPS, MetricBlockRatio, MetricPayloadSizeMean, MetricPayloadSizeP95, MetricUniqueIPs}
+
+// minStdDev keeps a metric that barely varied while learning from alerting
+// on the smallest change
+var minStdDev = map[string]float64{
+	MetricRPS:             1,
+	MetricBlockRatio:      0.02,
+	MetricPayloadSizeMean: 16,
+	MetricPayloadSizeP95:  64,
+	MetricUniqueIPs:       5,
+}
+
+// BaselineConfig controls learning what normal traffic looks like for each
+// hour of the day and alerting on minutes well above it
+type BaselineConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Smoothing   float64  `json:"smoothing"`    // EWMA weight of the newest minute, 0 < x <= 1
+	Deviation   float64  `json:"deviation"`    // Alert above mean + Deviation * stddev
+	Warmup      int      `json:"warmup"`       // Minutes learned for an hour of the day before it alerts
+	MinRequests int64    `json:"min_requests"` // Minutes with fewer requests are learned but never alert
+	Cooldown    Duration `json:"cooldown"`     // Least time between alerts for the same metric
+	Adapt       int      `json:"adapt"`        // Deviating minutes in a row for an hour of the day before they're learned
+}
+
+// DefaultBaselineConfig returns the baseline settings used out of the box
+func DefaultBaselineConfig() BaselineConfig {
+	return BaselineConfig{
+		Enabled:     true,
+		Smoothing:   0.05,
+		Deviation:   4,
+		Warmup:      120,
+		MinRequests: 60,
+		Cooldown:    Duration(15 * time.Minute),
+		Adapt:       60,
+	}
+}
+
+func (c BaselineConfig) validate() error {
+	if c.Enabled && (c.Smoothing <= 0 || c.Smoothing > 1 || c.Deviation <= 0 || c.Warmup < 1 || c.Cooldown <= 0 || c.Adapt < 1) {
+		return errors.New("baseline smoothing must be in (0, 1], deviation and cooldown positive and warmup and adapt at least 1")
+	}
+	return nil
+}
+
+// MetricBaseline is the learned normal range of one metric for one hour of the day
+type MetricBaseline struct {
+	Mean    float64 `json:"mean"`
+	Var     float64 `json:"var"`
+	Learned int     `json:"learned"`          // Minutes folded in
+	Streak  int     `json:"streak,omitempty"` // Alerting minutes in a row that deviated
+}
+
+// stdDev returns the standard deviation, never below the metric's floor
+func (b MetricBaseline) stdDev(metric string) float64 {
+	return math.Max(math.Sqrt(b.Var), minStdDev[metric])
+}
+
+// learn folds x into the baseline
+func (b *MetricBaseline) learn(x, smoothing float64) {
+	if b.Learned == 0 {
+		b.Mean = x
+	} else {
+		diff := x - b.Mean
+		incr := smoothing * diff
+		b.Mean += incr
+		b.Var = (1 - smoothing) * (b.Var + diff*incr)
+	}
+	b.Learned++
+}
+
+// baselineState is what is persisted to Redis
+type baselineState struct {
+	Metrics map[string]*[baselineHoursPerDay]MetricBaseline `json:"metrics"`
+	SavedAt int64                                           `json:"saved_at"` // Unix seconds
+}
+
+type baselineMinute struct {
+	requests int64
+	blocked  int64
+	bytes    int64
+	sizes    [payloadSizeBuckets]int64
+}
+
+// BaselineSample is one minute of cluster traffic as the baseline sees it
+type BaselineSample struct {
+	Minute  int64              `json:"minute"` // Unix seconds at the start of the minute
+	Values  map[string]float64 `json:"values"`
+	ZScores map[string]float64 `json:"z_scores,omitempty"` // Only for hours past warm-up
+}
+
+// BaselineLearner batches per-minute traffic into Redis and learns, for each
+// hour of the day (UTC), the normal range of every metric
+type BaselineLearner struct {
+	rdb redis.Cmdable
+
+	mu      sync.Mutex
+	pending map[int64]*baselineMinute // Keyed by minute, not yet flushed
+
+	stateMu sync.Mutex
+	state   baselineState
+	last    BaselineSample
+}
+
+// NewBaselineLearner returns a learner with nothing learned, writing to rdb
+func NewBaselineLearner(rdb redis.Cmdable) *BaselineLearner {
+	b := &BaselineLearner{rdb: rdb, pending: make(map[int64]*baselineMinute)}
+	b.state.Metrics = make(map[string]*[baselineHoursPerDay]MetricBaseline, len(baselineMetrics))
+	for _, m := range baselineMetrics {
+		b.state.Metrics[m] = &[baselineHoursPerDay]MetricBaseline{}
+	}
+	return b
+}
+
+func sizeBucket(size int) int {
+	return min(bits.Len(uint(size)), payloadSizeBuckets-1)
+}
+
+// Record counts one request with a payload of size bytes
+func (b *BaselineLearner) Record(size int, blocked bool, now time.Time) {
+	minute := minuteOf(now)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.pending[minute]
+	if !ok {
+		m = &baselineMinute{}
+		b.pending[minute] = m
+	}
+	m.requests++
+	if blocked {
+		m.blocked++
+	}
+	m.bytes += int64(size)
+	m.sizes[sizeBucket(size)]++
+}
+
+// flush adds the pending counts to Redis
+func (b *BaselineLearner) flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[int64]*baselineMinute, 1)
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	pipe := b.rdb.Pipeline()
+	for minute, m := range pending {
+		key := fmt.Sprintf("%s%d", baselineKeyPrefix, minute)
+		pipe.HIncrBy(ctx, key, "requests", m.requests)
+		pipe.HIncrBy(ctx, key, "blocked", m.blocked)
+		pipe.HIncrBy(ctx, key, "bytes", m.bytes)
+		for i, n := range m.sizes {
+			if n > 0 {
+				pipe.HIncrBy(ctx, key, "size"+strconv.Itoa(i), n)
+			}
+		}
+		pipe.Expire(ctx, key, baselineKeyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// sample reads the cluster's counts for minute from Redis. The unique IP
+// count comes from the cardinality monitor's HyperLogLog.
+func (b *BaselineLearner) sample(ctx context.Context, minute int64) (BaselineSample, int64, error) {
+	pipe := b.rdb.Pipeline()
+	countsCmd := pipe.HGetAll(ctx, fmt.Sprintf("%s%d", baselineKeyPrefix, minute))
+	uniqueCmd := pipe.PFCount(ctx, fmt.Sprintf("%s%d", uniqueIPsKeyPrefix, minute))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return BaselineSample{}, 0, err
+	}
+
+	var requests, blocked, bytes int64
+	var sizes [payloadSizeBuckets]int64
+	for field, v := range countsCmd.Val() {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case "requests":
+			requests = n
+		case "blocked":
+			blocked = n
+		case "bytes":
+			bytes = n
+		default:
+			bucket, ok := strings.CutPrefix(field, "size")
+			if i, err := strconv.Atoi(bucket); ok && err == nil && i >= 0 && i < payloadSizeBuckets {
+				sizes[i] = n
+			}
+		}
+	}
+
+	sample := BaselineSample{Minute: minute, Values: map[string]float64{
+		MetricRPS:       float64(requests) / 60,
+		MetricUniqueIPs: float64(uniqueCmd.Val()),
+	}}
+	if requests > 0 {
+		sample.Values[MetricBlockRatio] = float64(blocked) / float64(requests)
+		sample.Values[MetricPayloadSizeMean] = float64(bytes) / float64(requests)
+		sample.Values[MetricPayloadSizeP95] = sizeQuantile(sizes, requests, payloadSizeQuantile)
+	}
+	return sample, requests, nil
+}
+
+// sizeQuantile returns the upper bound of the bucket holding quantile q
+func sizeQuantile(sizes [payloadSizeBuckets]int64, total int64, q float64) float64 {
+	want := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, n := range sizes {
+		seen += n
+		if seen >= want {
+			if i == 0 {
+				return 0
+			}
+			return float64(uint64(1)<<i - 1)
+		}
+	}
+	return float64(uint64(1)<<(payloadSizeBuckets-1) - 1)
+}
+
+// Deviation is a metric found well above its baseline
+type Deviation struct {
+	Metric string
+	Value  float64
+	Mean   float64
+	StdDev float64
+	Z      float64
+}
+
+// observe scores sample against the baselines for its hour, then folds it
+// in. Values that deviate in an alerting minute are kept out of the baseline
+// so a short attack doesn't become normal, until cfg.Adapt of them in a row
+// show the shift is lasting. Metrics missing from the sample (no requests)
+// are skipped.
+func (b *BaselineLearner) observe(cfg BaselineConfig, sample BaselineSample, alerting bool) []Deviation {
+	hour := time.Unix(sample.Minute, 0).UTC().Hour()
+
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	var deviations []Deviation
+	sample.ZScores = make(map[string]float64)
+	for _, metric := range baselineMetrics {
+		x, ok := sample.Values[metric]
+		if !ok {
+			continue
+		}
+		base := &b.state.Metrics[metric][hour]
+		if base.Learned >= cfg.Warmup {
+			stddev := base.stdDev(metric)
+			z := (x - base.Mean) / stddev
+			sample.ZScores[metric] = z
+			switch {
+			case z <= cfg.Deviation:
+				base.Streak = 0
+			case !alerting:
+				// Too few requests to alert on, so nothing to hold back
+			case base.Streak < cfg.Adapt:
+				base.Streak++
+				deviations = append(deviations, Deviation{Metric: metric, Value: x, Mean: base.Mean, StdDev: stddev, Z: z})
+				continue
+			}
+		}
+		base.learn(x, cfg.Smoothing)
+	}
+	b.last = sample
+	return deviations
+}
+
+// snapshot returns the state to persist
+func (b *BaselineLearner) snapshot(now time.Time) ([]byte, error) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.state.SavedAt = now.Unix()
+	return json.Marshal(b.state)
+}
+
+// restore replaces the learned baselines with ones saved earlier. Metrics
+// the saved state lacks keep what was learned.
+func (b *BaselineLearner) restore(data []byte) error {
+	var st baselineState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	for metric, hours := range st.Metrics {
+		if _, ok := b.state.Metrics[metric]; ok && hours != nil {
+			b.state.Metrics[metric] = hours
+		}
+	}
+	return nil
+}
+
+// BaselineHour is the learned range of every metric for one hour of the day
+type BaselineHour struct {
+	Hour    int                       `json:"hour"` // UTC
+	Metrics map[string]BaselineMetric `json:"metrics"`
+}
+
+// BaselineMetric is one metric of a BaselineHour
+type BaselineMetric struct {
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stddev"`
+	Learned int     `json:"learned"`
+}
+
+// BaselineSnapshot is returned by GET /api/baselines
+type BaselineSnapshot struct {
+	Hours []BaselineHour `json:"hours"`
+	Last  BaselineSample `json:"last"` // Most recent minute evaluated
+}
+
+// Snapshot returns the baselines for hours, or for every hour when hours is empty
+func (b *BaselineLearner) Snapshot(hours []int) BaselineSnapshot {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	if len(hours) == 0 {
+		for h := 0; h < baselineHoursPerDay; h++ {
+			hours = append(hours, h)
+		}
+	}
+	snapshot := BaselineSnapshot{Last: b.last}
+	for _, h := range hours {
+		hour := BaselineHour{Hour: h, Metrics: make(map[string]BaselineMetric, len(baselineMetrics))}
+		for _, metric := range baselineMetrics {
+			base := b.state.Metrics[metric][h]
+			hour.Metrics[metric] = BaselineMetric{Mean: base.Mean, StdDev: base.stdDev(metric), Learned: base.Learned}
+		}
+		snapshot.Hours = append(snapshot.Hours, hour)
+	}
+	return snapshot
+}
+
+// loadBaselines restores the baselines saved by any server, reporting
+// whether there were any
+func (s *Server) loadBaselines(ctx context.Context) (bool, error) {
+	data, err := s.rdb.Get(ctx, baselineStateKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", baselineStateKey, err)
+	}
+	if err := s.baseline.restore(data); err != nil {
+		log.Printf("Warm-up: ignoring unreadable baselines: %v", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// startBaselineLearner flushes counts every second and learns from each
+// completed minute. Every server reads the same cluster-wide counts, so they
+// learn the same baselines; the first to claim a deviation raises the alert.
+func (s *Server) startBaselineLearner(ctx context.Context) {
+	flushTicker := time.NewTicker(baselineFlushInterval)
+	defer flushTicker.Stop()
+
+	lastEvaluated := minuteOf(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-flushTicker.C:
+			if err := s.baseline.flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Baseline flush error: %v", err)
+			}
+
+			// Evaluate the previous minute once every server has had time to flush it
+			previous := minuteOf(now.Add(-cardinalitySettleDelay)) - 60
+			if previous <= lastEvaluated {
+				continue
+			}
+			lastEvaluated = previous
+			s.evaluateBaseline(ctx, previous)
+		}
+	}
+}
+
+func (s *Server) evaluateBaseline(ctx context.Context, minute int64) {
+	cfg := s.config().Baseline
+	if !cfg.Enabled {
+		return
+	}
+
+	sample, requests, err := s.baseline.sample(ctx, minute)
+	if err != nil {
+		log.Printf("Baseline sample error: %v", err)
+		return
+	}
+	deviations := s.baseline.observe(cfg, sample, requests >= cfg.MinRequests)
+
+	data, err := s.baseline.snapshot(time.Now())
+	if err == nil {
+		if err := s.rdb.Set(ctx, baselineStateKey, data, baselineStateTTL).Err(); err != nil {
+			log.Printf("Baseline save error: %v", err)
+		}
+	}
+
+	hour := time.Unix(minute, 0).UTC().Hour()
+	for _, d := range deviations {
+		// Every server sees the same deviation; let the first one alert
+		key := baselineAlertPrefix + d.Metric
+		if first, err := s.rdb.SetNX(ctx, key, minute, time.Duration(cfg.Cooldown)).Result(); err != nil || !first {
+			continue
+		}
+		s.raiseAlert(ctx, Alert{
+			Kind:     "baseline_deviation",
+			Severity: SeverityWarning,
+			Message: fmt.Sprintf("%s is %.1fσ above its %02d:00 UTC baseline: %.4g (normal %.4g ± %.4g)",
+				d.Metric, d.Z, hour, d.Value, d.Mean, d.StdDev),
+			Details: map[string]any{
+				"metric":   d.Metric,
+				"minute":   minute,
+				"value":    d.Value,
+				"mean":     d.Mean,
+				"stddev":   d.StdDev,
+				"z_score":  d.Z,
+				"hour_utc": hour,
+			},
+		})
+	}
+}
+
+// baselinesHandler serves GET /api/baselines?hour=N. Without hour every hour
+// of the day is returned.
+func (s *Server) baselinesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var hours []int
+	if v := r.URL.Query().Get("hour"); v != "" {
+		h, err := strconv.Atoi(v)
+		if err != nil || h < 0 || h >= baselineHoursPerDay {
+			http.Error(w, "hour must be from 0 to 23", http.StatusBadRequest)
+			return
+		}
+		hours = []int{h}
+	}
+	writeJSON(w, http.StatusOK, s.baseline.Snapshot(hours))
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSizeQuantile(t *testing.T) {
+	var sizes [payloadSizeBuckets]int64
+	for i := 0; i < 90; i++ {
+		sizes[sizeBucket(100)]++ // 64-127
+	}
+	for i := 0; i < 10; i++ {
+		sizes[sizeBucket(5000)]++ // 4096-8191
+	}
+	if got := sizeQuantile(sizes, 100, 0.9); got != 127 {
+		t.Errorf("p90 = %v, want 127", got)
+	}
+	if got := sizeQuantile(sizes, 100, 0.95); got != 8191 {
+		t.Errorf("p95 = %v, want 8191", got)
+	}
+	if got := sizeBucket(0); got != 0 {
+		t.Errorf("sizeBucket(0) = %d, want 0", got)
+	}
+}
+
+func TestBaselineObserve(t *testing.T) {
+	cfg := DefaultBaselineConfig()
+	cfg.Warmup = 10
+	b := NewBaselineLearner(nil)
+
+	// 03:00 UTC learns about 100 RPS; nothing alerts during warm-up
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC).Unix()
+	for i := 0; i < cfg.Warmup; i++ {
+		sample := BaselineSample{Minute: start + int64(i)*60, Values: map[string]float64{
+			MetricRPS:        100 + float64(i%3),
+			MetricBlockRatio: 0.01,
+		}}
+		if got := b.observe(cfg, sample, true); len(got) != 0 {
+			t.Fatalf("minute %d alerted during warm-up: %+v", i, got)
+		}
+	}
+
+	normal := BaselineSample{Minute: start + 600, Values: map[string]float64{MetricRPS: 101, MetricBlockRatio: 0.01}}
+	if got := b.observe(cfg, normal, true); len(got) != 0 {
+		t.Errorf("normal minute alerted: %+v", got)
+	}
+
+	spike := BaselineSample{Minute: start + 660, Values: map[string]float64{MetricRPS: 400, MetricBlockRatio: 0.5}}
+	got := b.observe(cfg, spike, true)
+	if len(got) != 2 || got[0].Metric != MetricRPS || got[1].Metric != MetricBlockRatio {
+		t.Fatalf("spike deviations = %+v, want rps and block_ratio", got)
+	}
+
+	// The spike was not learned, and other hours are unaffected
+	snap := b.Snapshot([]int{3, 4})
+	if mean := snap.Hours[0].Metrics[MetricRPS].Mean; mean > 102 {
+		t.Errorf("03:00 rps mean = %v, spike was learned", mean)
+	}
+	if learned := snap.Hours[1].Metrics[MetricRPS].Learned; learned != 0 {
+		t.Errorf("04:00 learned %d minutes, want 0", learned)
+	}
+
+	// Quiet minutes past warm-up are scored but don't alert
+	if got := b.observe(cfg, spike, false); len(got) != 0 {
+		t.Errorf("minute below min_requests alerted: %+v", got)
+	}
+}
+
+func TestBaselinePersistence(t *testing.T) {
+	cfg := DefaultBaselineConfig()
+	b := NewBaselineLearner(nil)
+	minute := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC).Unix()
+	b.observe(cfg, BaselineSample{Minute: minute, Values: map[string]float64{MetricUniqueIPs: 250}}, true)
+
+	data, err := b.snapshot(time.Now())
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	restored := NewBaselineLearner(nil)
+	if err := restored.restore(data); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	got := restored.Snapshot([]int{14}).Hours[0].Metrics[MetricUniqueIPs]
+	if got.Mean != 250 || got.Learned != 1 {
+		t.Errorf("restored unique_ips = %+v, want mean 250 after 1 minute", got)
+	}
+	if err := restored.restore([]byte("not json")); err == nil {
+		t.Error("restore accepted unreadable state")
+	}
+}
+
+func TestBaselineLearnsLastingShift(t *testing.T) {
+	cfg := DefaultBaselineConfig()
+	cfg.Warmup = 10
+	cfg.Adapt = 5
+	b := NewBaselineLearner(nil)
+
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC).Unix()
+	minute := func(i int, rps float64, alerting bool) []Deviation {
+		return b.observe(cfg, BaselineSample{Minute: start + int64(i)*60, Values: map[string]float64{MetricRPS: rps}}, alerting)
+	}
+	for i := 0; i < cfg.Warmup; i++ {
+		minute(i, 100, true)
+	}
+
+	// Below min_requests a deviating minute is still learned
+	before := b.Snapshot([]int{3}).Hours[0].Metrics[MetricRPS].Mean
+	minute(10, 400, false)
+	if mean := b.Snapshot([]int{3}).Hours[0].Metrics[MetricRPS].Mean; mean <= before {
+		t.Errorf("quiet deviating minute not learned: mean %v -> %v", before, mean)
+	}
+
+	// Traffic steps up for good: it alerts for adapt minutes, then becomes normal
+	alerts := 0
+	for i := 11; i < 200; i++ {
+		if got := minute(i, 1000, true); len(got) != 0 {
+			alerts++
+		}
+	}
+	if alerts != cfg.Adapt {
+		t.Errorf("lasting shift alerted %d minutes, want %d", alerts, cfg.Adapt)
+	}
+	if mean := b.Snapshot([]int{3}).Hours[0].Metrics[MetricRPS].Mean; mean < 900 {
+		t.Errorf("03:00 rps mean = %v, lasting shift wasn't learned", mean)
+	}
+	if got := minute(200, 1000, true); len(got) != 0 {
+		t.Errorf("new normal still alerts: %+v", got)
+	}
+}
@@ -0,0 +1,411 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	blocklistKey             = "blocklist"          // Redis hash: target -> JSON BlockEntry
+	blocklistVersionsKey     = "blocklist_versions" // Redis hash: target -> Unix ms of its last add or remove
+	blocklistChangesKey      = "blocklist_changes"  // Redis stream of local adds and removes, read by other regions
+	blocklistChangesMaxLen   = 100000
+	blocklistRefreshInterval = 10 * time.Second
+)
+
+// LocalBlocklist is the L1 cache of blocked IPs, checked before Redis
+type LocalBlocklist struct {
+	mu    sync.RWMutex
+	items map[string]time.Time
+}
+
+// NewLocalBlocklist returns an empty blocklist
+func NewLocalBlocklist() *LocalBlocklist {
+	return &LocalBlocklist{
+		items: make(map[string]time.Time),
+	}
+}
+
+func (b *LocalBlocklist) IsBlocked(ip string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	expiry, exists := b.items[ip]
+	if !exists {
+		return false
+	}
+
+	if time.Now().Before(expiry) {
+		return true
+	}
+	return false
+}
+
+// Remaining returns how much longer ip stays blocked, or 0 if it isn't
+func (b *LocalBlocklist) Remaining(ip string) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return max(0, time.Until(b.items[ip]))
+}
+
+func (b *LocalBlocklist) Block(ip string, ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items[ip] = time.Now().Add(ttl)
+}
+
+// Unblock removes ip and reports whether it was blocked
+func (b *LocalBlocklist) Unblock(ip string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.items[ip]
+	delete(b.items, ip)
+	return ok
+}
+
+func (b *LocalBlocklist) Cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for ip, expiry := range b.items {
+		if now.After(expiry) {
+			delete(b.items, ip)
+		}
+	}
+}
+
+// BlockEntry is one operator-managed block: a single IP or a CIDR range
+type BlockEntry struct {
+	Target    string `json:"target"` // IP or CIDR
+	Reason    string `json:"reason,omitempty"`
+	Source    string `json:"source,omitempty"`     // "manual", "import" or a feed URL/path
+	CreatedAt int64  `json:"created_at"`           // Unix seconds
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix seconds, 0 = permanent
+}
+
+// describe is the message returned to agents blocked by this entry
+func (e BlockEntry) describe() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("IP is blocklisted (%s)", e.Target)
+	}
+	return fmt.Sprintf("IP is blocklisted (%s): %s", e.Target, e.Reason)
+}
+
+func (e BlockEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != 0 && now.Unix() >= e.ExpiresAt
+}
+
+// remaining is how long the entry still blocks, or 0 for a permanent entry
+func (e BlockEntry) remaining(now time.Time) time.Duration {
+	if e.ExpiresAt == 0 {
+		return 0
+	}
+	return max(0, time.Unix(e.ExpiresAt, 0).Sub(now))
+}
+
+// NormalizeTarget parses an IP or CIDR and returns its canonical form.
+// Single-address prefixes (/32, /128) collapse to the plain IP.
+func NormalizeTarget(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return addr.Unmap().String(), nil
+	}
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP or CIDR", target)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String(), nil
+	}
+	return prefix.Masked().String(), nil
+}
+
+// Blocklist is the operator-managed list of blocked IPs and ranges. Redis is
+// the source of truth so every server shares it; each server keeps an
+// in-memory copy for per-request lookups and refreshes it periodically.
+type Blocklist struct {
+	rdb    redis.Cmdable
+	region string // Set by EnableJournal; local changes are journaled for other regions
+
+	mu         sync.RWMutex
+	ips        map[netip.Addr]BlockEntry
+	prefixes   map[netip.Prefix]BlockEntry
+	prefixLens prefixLengths // Lengths in use, so Match looks up each once
+}
+
+// prefixLengths counts blocked ranges by prefix length
+type prefixLengths [129]int
+
+func (l *prefixLengths) add(p netip.Prefix) {
+	l[p.Bits()]++
+}
+
+func (l *prefixLengths) remove(p netip.Prefix) {
+	l[p.Bits()]--
+}
+
+// NewBlocklist returns an empty blocklist backed by rdb. Call Refresh to load it.
+func NewBlocklist(rdb redis.Cmdable) *Blocklist {
+	return &Blocklist{
+		rdb:      rdb,
+		ips:      make(map[netip.Addr]BlockEntry),
+		prefixes: make(map[netip.Prefix]BlockEntry),
+	}
+}
+
+// EnableJournal versions every add and remove and records it in the change
+// stream other regions read. Call it before the blocklist is shared.
+func (b *Blocklist) EnableJournal(region string) {
+	b.region = region
+}
+
+// journal records local changes. entries holds the added entries or, for
+// removals, entries with only Target set.
+func (b *Blocklist) journal(ctx context.Context, entries []BlockEntry, removed bool) error {
+	if b.region == "" {
+		return nil
+	}
+
+	version := time.Now().UnixMilli()
+	pipe := b.rdb.Pipeline()
+	for _, e := range entries {
+		change := BlocklistChange{Target: e.Target, Version: version, Region: b.region}
+		if !removed {
+			entry := e
+			change.Entry = &entry
+		}
+		pipe.HSet(ctx, blocklistVersionsKey, e.Target, version)
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: blocklistChangesKey,
+			MaxLen: blocklistChangesMaxLen,
+			Approx: true,
+			Values: change.values(),
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Add stores entries in Redis and the local copy, replacing existing entries for the same target
+func (b *Blocklist) Add(ctx context.Context, entries []BlockEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	values := make([]interface{}, 0, 2*len(entries))
+	for i := range entries {
+		target, err := NormalizeTarget(entries[i].Target)
+		if err != nil {
+			return err
+		}
+		entries[i].Target = target
+		if entries[i].CreatedAt == 0 {
+			entries[i].CreatedAt = now
+		}
+
+		data, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+		values = append(values, target, data)
+	}
+
+	if err := b.rdb.HSet(ctx, blocklistKey, values...).Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	for _, e := range entries {
+		b.setLocked(e)
+	}
+	b.mu.Unlock()
+	return b.journal(ctx, entries, false)
+}
+
+// Remove deletes targets from Redis and the local copy and returns how many existed
+func (b *Blocklist) Remove(ctx context.Context, targets []string) (int, error) {
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	normalized := make([]string, 0, len(targets))
+	for _, t := range targets {
+		target, err := NormalizeTarget(t)
+		if err != nil {
+			return 0, err
+		}
+		normalized = append(normalized, target)
+	}
+
+	// One HDEL per target tells which ones existed; only those are journaled
+	pipe := b.rdb.Pipeline()
+	dels := make([]*redis.IntCmd, len(normalized))
+	for i, target := range normalized {
+		dels[i] = pipe.HDel(ctx, blocklistKey, target)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	var removed []BlockEntry
+	for i, target := range normalized {
+		b.deleteLocked(target)
+		if dels[i].Val() > 0 {
+			removed = append(removed, BlockEntry{Target: target})
+		}
+	}
+	b.mu.Unlock()
+	return len(removed), b.journal(ctx, removed, true)
+}
+
+// Refresh reloads the local copy from Redis and purges expired entries
+func (b *Blocklist) Refresh(ctx context.Context) error {
+	raw, err := b.rdb.HGetAll(ctx, blocklistKey).Result()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ips := make(map[netip.Addr]BlockEntry)
+	prefixes := make(map[netip.Prefix]BlockEntry)
+	var lens prefixLengths
+	var expired []string
+
+	for target, data := range raw {
+		var e BlockEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			log.Printf("Blocklist: skipping unreadable entry %q: %v", target, err)
+			continue
+		}
+		if e.expired(now) {
+			expired = append(expired, target)
+			continue
+		}
+		if addr, err := netip.ParseAddr(e.Target); err == nil {
+			ips[addr] = e
+		} else if prefix, err := netip.ParsePrefix(e.Target); err == nil {
+			if _, ok := prefixes[prefix]; !ok {
+				lens.add(prefix)
+			}
+			prefixes[prefix] = e
+		}
+	}
+
+	if len(expired) > 0 {
+		if err := b.rdb.HDel(ctx, blocklistKey, expired...).Err(); err != nil {
+			log.Printf("Blocklist: failed to purge %d expired entries: %v", len(expired), err)
+		}
+	}
+
+	b.mu.Lock()
+	b.ips, b.prefixes, b.prefixLens = ips, prefixes, lens
+	b.mu.Unlock()
+	return nil
+}
+
+// Match returns the entry blocking ip: an exact IP, or else the most specific
+// range containing it. Ranges are looked up once per prefix length in use.
+func (b *Blocklist) Match(ip string) (BlockEntry, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return BlockEntry{}, false
+	}
+	addr = addr.Unmap()
+	now := time.Now()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if e, ok := b.ips[addr]; ok && !e.expired(now) {
+		return e, true
+	}
+	for bits := addr.BitLen(); bits >= 0; bits-- {
+		if b.prefixLens[bits] == 0 {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if e, ok := b.prefixes[prefix]; ok && !e.expired(now) {
+			return e, true
+		}
+	}
+	return BlockEntry{}, false
+}
+
+// Entries returns the active entries sorted by target
+func (b *Blocklist) Entries() []BlockEntry {
+	now := time.Now()
+
+	b.mu.RLock()
+	entries := make([]BlockEntry, 0, len(b.ips)+len(b.prefixes))
+	for _, e := range b.ips {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	for _, e := range b.prefixes {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Target < entries[j].Target })
+	return entries
+}
+
+func (b *Blocklist) setLocked(e BlockEntry) {
+	if addr, err := netip.ParseAddr(e.Target); err == nil {
+		b.ips[addr] = e
+	} else if prefix, err := netip.ParsePrefix(e.Target); err == nil {
+		if _, ok := b.prefixes[prefix]; !ok {
+			b.prefixLens.add(prefix)
+		}
+		b.prefixes[prefix] = e
+	}
+}
+
+func (b *Blocklist) deleteLocked(target string) {
+	if addr, err := netip.ParseAddr(target); err == nil {
+		delete(b.ips, addr)
+	} else if prefix, err := netip.ParsePrefix(target); err == nil {
+		if _, ok := b.prefixes[prefix]; ok {
+			b.prefixLens.remove(prefix)
+			delete(b.prefixes, prefix)
+		}
+	}
+}
+
+// startBlocklistRefresher keeps the local copy in sync with changes made by other servers
+func (s *Server) startBlocklistRefresher(ctx context.Context) {
+	ticker := time.NewTicker(blocklistRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.blocklist.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Blocklist refresh error: %v", err)
+			}
+		}
+	}
+}
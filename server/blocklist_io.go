@@ -0,0 +1,552 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Blocklist formats accepted by import and export
+const (
+	FormatText  = "text"  // One IP or CIDR per line, '#' and ';' start comments
+	FormatCSV   = "csv"   // target,reason,source,created_at,expires_at with an optional header
+	FormatIPSet = "ipset" // `ipset save` / `ipset restore` syntax
+)
+
+const (
+	ipsetName        = "ids-blocklist"  // IPv4 set name used on export
+	ipsetName6       = "ids-blocklist6" // IPv6 set name used on export
+	maxImportSize    = 32 << 20
+	feedFetchTimeout = 30 * time.Second
+)
+
+// BlocklistFeed is a list that is imported at startup and then re-imported
+// every Interval. Entries that disappear from the feed are removed.
+type BlocklistFeed struct {
+	Source   string   `json:"source"`   // http(s) URL or local file path
+	Format   string   `json:"format"`   // text, csv or ipset
+	Interval Duration `json:"interval"` // 0 imports once at startup
+	TTL      Duration `json:"ttl"`      // 0 keeps entries until the feed drops them
+	Reason   string   `json:"reason"`
+}
+
+func validFormat(format string) bool {
+	return format == FormatText || format == FormatCSV || format == FormatIPSet
+}
+
+// ParseBlocklist reads entries in the given format. Fields missing from the
+// input (reason, source, expiry) are taken from template.
+func ParseBlocklist(r io.Reader, format string, template BlockEntry) ([]BlockEntry, error) {
+	switch format {
+	case FormatText:
+		return parseText(r, template)
+	case FormatCSV:
+		return parseCSV(r, template)
+	case FormatIPSet:
+		return parseIPSet(r, template)
+	default:
+		return nil, fmt.Errorf("unknown blocklist format %q", format)
+	}
+}
+
+func parseText(r io.Reader, template BlockEntry) ([]BlockEntry, error) {
+	var entries []BlockEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		target, err := NormalizeTarget(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e := template
+		e.Target = target
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func parseCSV(r io.Reader, template BlockEntry) ([]BlockEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a header, only the first column (the target) is used
+	columns := map[string]int{"target": 0}
+	if len(records) > 0 && len(records[0]) > 0 {
+		if _, err := NormalizeTarget(records[0][0]); err != nil {
+			columns = make(map[string]int)
+			for i, name := range records[0] {
+				columns[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			records = records[1:]
+		}
+	}
+	targetCol, ok := columns["target"]
+	if !ok {
+		if targetCol, ok = columns["ip"]; !ok {
+			return nil, fmt.Errorf("csv header has no target or ip column")
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	entries := make([]BlockEntry, 0, len(records))
+	for i, record := range records {
+		if targetCol >= len(record) {
+			return nil, fmt.Errorf("row %d: missing target", i+1)
+		}
+		target, err := NormalizeTarget(record[targetCol])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		e := template
+		e.Target = target
+		if reason := field(record, "reason"); reason != "" {
+			e.Reason = reason
+		}
+		if source := field(record, "source"); source != "" {
+			e.Source = source
+		}
+		if expires := field(record, "expires_at"); expires != "" {
+			if e.ExpiresAt, err = strconv.ParseInt(expires, 10, 64); err != nil {
+				return nil, fmt.Errorf("row %d: invalid expires_at %q", i+1, expires)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseIPSet(r io.Reader, template BlockEntry) ([]BlockEntry, error) {
+	var entries []BlockEntry
+	scanner := bufio.NewScanner(r)
+	now := time.Now()
+	for line := 1; scanner.Scan(); line++ {
+		// add <set> <target> [timeout <seconds>] [...]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "add" {
+			continue
+		}
+
+		target, err := NormalizeTarget(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e := template
+		e.Target = target
+		for i := 3; i+1 < len(fields); i++ {
+			if fields[i] != "timeout" {
+				continue
+			}
+			seconds, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid timeout %q", line, fields[i+1])
+			}
+			if seconds > 0 {
+				e.ExpiresAt = now.Unix() + seconds
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteBlocklist writes entries in the given format
+func WriteBlocklist(w io.Writer, format string, entries []BlockEntry) error {
+	switch format {
+	case FormatText:
+		return writeText(w, entries)
+	case FormatCSV:
+		return writeCSV(w, entries)
+	case FormatIPSet:
+		return writeIPSet(w, entries)
+	default:
+		return fmt.Errorf("unknown blocklist format %q", format)
+	}
+}
+
+func writeText(w io.Writer, entries []BlockEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# intrusiondetection blocklist, %d entries, exported %s\n", len(entries), time.Now().UTC().Format(time.RFC3339))
+	for _, e := range entries {
+		fmt.Fprintln(bw, e.Target)
+	}
+	return bw.Flush()
+}
+
+func writeCSV(w io.Writer, entries []BlockEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"target", "reason", "source", "created_at", "expires_at"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Target,
+			e.Reason,
+			e.Source,
+			strconv.FormatInt(e.CreatedAt, 10),
+			strconv.FormatInt(e.ExpiresAt, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeIPSet emits a file for `ipset restore -exist`. Sets are created with
+// timeout support so expiring entries keep their remaining lifetime.
+func writeIPSet(w io.Writer, entries []BlockEntry) error {
+	bw := bufio.NewWriter(w)
+	now := time.Now().Unix()
+
+	var v4, v6 []BlockEntry
+	for _, e := range entries {
+		if isIPv6Target(e.Target) {
+			v6 = append(v6, e)
+		} else {
+			v4 = append(v4, e)
+		}
+	}
+
+	write := func(name, family string, entries []BlockEntry) {
+		fmt.Fprintf(bw, "create %s hash:net family %s timeout 0\n", name, family)
+		for _, e := range entries {
+			if e.ExpiresAt == 0 {
+				fmt.Fprintf(bw, "add %s %s\n", name, e.Target)
+			} else if remaining := e.ExpiresAt - now; remaining > 0 {
+				fmt.Fprintf(bw, "add %s %s timeout %d\n", name, e.Target, remaining)
+			}
+		}
+	}
+	write(ipsetName, "inet", v4)
+	if len(v6) > 0 {
+		write(ipsetName6, "inet6", v6)
+	}
+	return bw.Flush()
+}
+
+func isIPv6Target(target string) bool {
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return addr.Is6()
+	}
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		return prefix.Addr().Is6()
+	}
+	return false
+}
+
+// OpenBlocklistSource opens an http(s) URL or, when allowFiles is set, a local file
+func OpenBlocklistSource(ctx context.Context, source string, allowFiles bool) (io.ReadCloser, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		ctx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("fetch %s: %s", source, resp.Status)
+		}
+		return &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}, nil
+	}
+
+	if !allowFiles {
+		return nil, fmt.Errorf("%q is not an http(s) URL", source)
+	}
+	return os.Open(source)
+}
+
+// cancelReadCloser releases the fetch timeout once the body is closed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// ImportFeed replaces the entries previously imported from feed with its
+// current contents. Targets already blocked by hand, by an import or by
+// another feed keep their entry and are never removed by the feed. Only
+// entries that are new or changed are written, so a re-import of an unchanged
+// feed journals nothing for other regions. It returns how many entries the
+// feed holds.
+func (b *Blocklist) ImportFeed(ctx context.Context, feed BlocklistFeed) (int, error) {
+	body, err := OpenBlocklistSource(ctx, feed.Source, true)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	template := BlockEntry{Source: feed.Source, Reason: feed.Reason}
+	if feed.TTL > 0 {
+		template.ExpiresAt = time.Now().Add(time.Duration(feed.TTL)).Unix()
+	}
+	parsed, err := ParseBlocklist(io.LimitReader(body, maxImportSize), feed.Format, template)
+	if err != nil {
+		return 0, err
+	}
+
+	existing := b.Entries()
+	byTarget := make(map[string]BlockEntry, len(existing))
+	for _, e := range existing {
+		byTarget[e.Target] = e
+	}
+	current := make(map[string]bool, len(parsed))
+	var held int
+	var changed []BlockEntry
+	for _, e := range parsed {
+		current[e.Target] = true
+		prev, ok := byTarget[e.Target]
+		if ok && prev.Source != feed.Source {
+			continue
+		}
+		held++
+		if !ok || prev.Reason != e.Reason || prev.ExpiresAt != e.ExpiresAt {
+			changed = append(changed, e)
+		}
+	}
+	if err := b.Add(ctx, changed); err != nil {
+		return 0, err
+	}
+
+	// Drop entries the feed no longer lists
+	var stale []string
+	for _, e := range existing {
+		if e.Source == feed.Source && !current[e.Target] {
+			stale = append(stale, e.Target)
+		}
+	}
+	if _, err := b.Remove(ctx, stale); err != nil {
+		return held, err
+	}
+	return held, nil
+}
+
+// startBlocklistFeed imports feed now and then on every interval
+func (s *Server) startBlocklistFeed(ctx context.Context, feed BlocklistFeed) {
+	importFeed := func() {
+		n, err := s.blocklist.ImportFeed(ctx, feed)
+		if err != nil {
+			log.Printf("Blocklist feed %s: import failed: %v", feed.Source, err)
+			return
+		}
+		log.Printf("Blocklist feed %s: imported %d entries", feed.Source, n)
+	}
+
+	importFeed()
+	if feed.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(feed.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			importFeed()
+		}
+	}
+}
+
+// BlockRequest is the body of POST /api/blocklist
+type BlockRequest struct {
+	Target string   `json:"target"`
+	Reason string   `json:"reason"`
+	TTL    Duration `json:"ttl"` // 0 blocks permanently
+}
+
+// block adds a manual blocklist entry and returns it as stored
+func (s *Server) block(ctx context.Context, req BlockRequest) (BlockEntry, error) {
+	entry := BlockEntry{Target: req.Target, Reason: req.Reason, Source: "manual"}
+	if req.TTL > 0 {
+		entry.ExpiresAt = time.Now().Add(time.Duration(req.TTL)).Unix()
+	}
+	entries := []BlockEntry{entry}
+	if err := s.blocklist.Add(ctx, entries); err != nil {
+		return BlockEntry{}, err
+	}
+	log.Printf("Blocklist: blocked %s (%s)", entries[0].Target, req.Reason)
+	return entries[0], nil
+}
+
+// unblock removes target from the blocklist and, for a single IP, also lifts
+// a rate limit block, so the IP is let through straight away. It returns how
+// many blocks were lifted.
+func (s *Server) unblock(ctx context.Context, target string) (int, error) {
+	target, err := NormalizeTarget(target)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.blocklist.Remove(ctx, []string{target})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := netip.ParseAddr(target); err == nil {
+		if s.localBlocklist.Unblock(target) {
+			n++
+		}
+		s.rdb.Del(ctx, fmt.Sprintf("ratelimit:%s", target))
+		s.rdb.ZRem(ctx, bansKey, target)
+	}
+	if n > 0 {
+		log.Printf("Blocklist: unblocked %s", target)
+	}
+	return n, nil
+}
+
+// blocklistHandler serves GET (list), POST (block) and DELETE ?target= (unblock) on /api/blocklist
+func (s *Server) blocklistHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.blocklist.Entries())
+
+	case http.MethodPost:
+		var req BlockRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		entry, err := s.block(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		n, err := s.unblock(r.Context(), target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n == 0 {
+			http.Error(w, fmt.Sprintf("%s is not blocklisted", target), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": n})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// blocklistExportHandler serves GET /api/blocklist/export?format=text|csv|ipset
+func (s *Server) blocklistExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatText
+	}
+	if !validFormat(format) {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	if format == FormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	WriteBlocklist(w, format, s.blocklist.Entries())
+}
+
+// blocklistImportHandler serves POST /api/blocklist/import. The list is read
+// from the request body, or fetched from ?url=. Optional ?ttl= and ?reason=
+// apply to every imported entry.
+func (s *Server) blocklistImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = FormatText
+	}
+	if !validFormat(format) {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	template := BlockEntry{Source: "import", Reason: q.Get("reason")}
+	if ttl := q.Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", ttl), http.StatusBadRequest)
+			return
+		}
+		template.ExpiresAt = time.Now().Add(d).Unix()
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if source := q.Get("url"); source != "" {
+		// Only URLs: the admin API must not read files off the server
+		rc, err := OpenBlocklistSource(r.Context(), source, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer rc.Close()
+		body = io.LimitReader(rc, maxImportSize)
+		template.Source = source
+	}
+
+	entries, err := ParseBlocklist(body, format, template)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.blocklist.Add(r.Context(), entries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("Blocklist: imported %d entries (%s)", len(entries), template.Source)
+	writeJSON(w, http.StatusOK, map[string]int{"imported": len(entries)})
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []string
+	}{
+		{
+			name:   "text with comments",
+			format: FormatText,
+			input:  "# header\n1.2.3.4\n10.0.0.0/8 ; SBL123\n\n2001:db8::/32 # docs\n5.6.7.8/32\n",
+			want:   []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32", "5.6.7.8"},
+		},
+		{
+			name:   "csv with header",
+			format: FormatCSV,
+			input:  "reason,ip\nscanner,1.2.3.4\nbotnet,192.168.1.7/24\n",
+			want:   []string{"1.2.3.4", "192.168.1.0/24"},
+		},
+		{
+			name:   "csv without header",
+			format: FormatCSV,
+			input:  "1.2.3.4,anything\n",
+			want:   []string{"1.2.3.4"},
+		},
+		{
+			name:   "ipset save",
+			format: FormatIPSet,
+			input:  "create bad hash:net family inet\nadd bad 1.2.3.4\nadd bad 10.1.0.0/16 timeout 60\n",
+			want:   []string{"1.2.3.4", "10.1.0.0/16"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseBlocklist(strings.NewReader(tt.input), tt.format, BlockEntry{})
+			if err != nil {
+				t.Fatalf("ParseBlocklist: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Target)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseBlocklist(strings.NewReader("1.2.3.4\nnot-an-ip\n"), FormatText, BlockEntry{}); err == nil {
+		t.Errorf("invalid entry accepted")
+	}
+}
+
+func TestBlocklistMatchAndRoundTrip(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	b := NewBlocklist(rdb)
+	err := b.Add(ctx, []BlockEntry{
+		{Target: "1.2.3.4", Reason: "scanner"},
+		{Target: "10.0.0.0/8"},
+		{Target: "2001:db8::/32", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		{Target: "9.9.9.9", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for ip, want := range map[string]bool{
+		"1.2.3.4":     true,
+		"10.20.30.40": true,
+		"2001:db8::1": true,
+		"9.9.9.9":     false, // expired
+		"11.0.0.1":    false,
+		"garbage":     false,
+	} {
+		if _, got := b.Match(ip); got != want {
+			t.Errorf("Match(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// A second instance sees the same list once refreshed, minus the expired entry
+	other := NewBlocklist(rdb)
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := len(other.Entries()); got != 3 {
+		t.Errorf("refreshed copy has %d entries, want 3", got)
+	}
+
+	for _, format := range []string{FormatText, FormatCSV, FormatIPSet} {
+		var buf bytes.Buffer
+		if err := WriteBlocklist(&buf, format, b.Entries()); err != nil {
+			t.Fatalf("%s: WriteBlocklist: %v", format, err)
+		}
+		parsed, err := ParseBlocklist(&buf, format, BlockEntry{})
+		if err != nil {
+			t.Fatalf("%s: ParseBlocklist: %v", format, err)
+		}
+		if len(parsed) != 3 {
+			t.Errorf("%s: round trip returned %d entries, want 3", format, len(parsed))
+		}
+	}
+
+	if n, err := b.Remove(ctx, []string{"10.0.0.0/8"}); err != nil || n != 1 {
+		t.Fatalf("Remove = %d, %v", n, err)
+	}
+	if _, ok := b.Match("10.20.30.40"); ok {
+		t.Errorf("removed range still matches")
+	}
+}
+
+func TestBlocklistMostSpecificRange(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	b := NewBlocklist(rdb)
+	err := b.Add(ctx, []BlockEntry{
+		{Target: "10.0.0.0/8", Reason: "wide"},
+		{Target: "10.1.0.0/16", Reason: "narrow"},
+		{Target: "10.1.2.0/24", Reason: "expired", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		{Target: "2001:db8::/32", Reason: "v6"},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for _, other := range []*Blocklist{b, NewBlocklist(rdb)} {
+		if err := other.Refresh(ctx); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+		for ip, want := range map[string]string{
+			"10.1.2.3":    "narrow", // The expired /24 falls through to the /16
+			"10.2.0.1":    "wide",
+			"2001:db8::9": "v6",
+		} {
+			if e, _ := other.Match(ip); e.Reason != want {
+				t.Errorf("Match(%s) = %q, want %q", ip, e.Reason, want)
+			}
+		}
+	}
+
+	if _, err := b.Remove(ctx, []string{"10.1.0.0/16"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if e, _ := b.Match("10.1.2.3"); e.Reason != "wide" {
+		t.Errorf("after removing the /16, Match = %q, want wide", e.Reason)
+	}
+}
+
+func TestImportFeedKeepsOtherSources(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	b := NewBlocklist(rdb)
+	if err := b.Add(ctx, []BlockEntry{{Target: "1.2.3.4", Source: "manual", Reason: "by hand"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	feed := BlocklistFeed{Source: filepath.Join(t.TempDir(), "feed.txt"), Format: FormatText}
+	importList := func(list string) int {
+		t.Helper()
+		if err := os.WriteFile(feed.Source, []byte(list), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		n, err := b.ImportFeed(ctx, feed)
+		if err != nil {
+			t.Fatalf("ImportFeed: %v", err)
+		}
+		return n
+	}
+
+	if n := importList("1.2.3.4\n5.6.7.8\n"); n != 1 {
+		t.Errorf("imported %d entries, want 1 (1.2.3.4 is blocked by hand)", n)
+	}
+	if e, _ := b.Match("1.2.3.4"); e.Source != "manual" {
+		t.Errorf("manual entry now has source %q", e.Source)
+	}
+
+	// The feed dropping both removes only its own entry
+	importList("")
+	if e, ok := b.Match("1.2.3.4"); !ok || e.Reason != "by hand" {
+		t.Errorf("manual entry removed by the feed: %+v, %v", e, ok)
+	}
+	if _, ok := b.Match("5.6.7.8"); ok {
+		t.Error("entry the feed dropped is still blocked")
+	}
+}
+
+func TestImportFeedJournalsChangesOnly(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	b := NewBlocklist(rdb)
+	b.EnableJournal("us")
+	feed := BlocklistFeed{Source: filepath.Join(t.TempDir(), "feed.txt"), Format: FormatText}
+	changes := func(list string) int64 {
+		t.Helper()
+		if err := os.WriteFile(feed.Source, []byte(list), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		before := rdb.XLen(ctx, blocklistChangesKey).Val()
+		if _, err := b.ImportFeed(ctx, feed); err != nil {
+			t.Fatalf("ImportFeed: %v", err)
+		}
+		return rdb.XLen(ctx, blocklistChangesKey).Val() - before
+	}
+
+	if n := changes("1.2.3.4\n5.6.7.8\n"); n != 2 {
+		t.Errorf("first import journaled %d changes, want 2", n)
+	}
+	if n := changes("1.2.3.4\n5.6.7.8\n"); n != 0 {
+		t.Errorf("unchanged re-import journaled %d changes, want 0", n)
+	}
+	if n := changes("1.2.3.4\n9.9.9.9\n"); n != 2 {
+		t.Errorf("re-import with one swap journaled %d changes, want 2", n)
+	}
+}
+
+func TestBlocklistRemoveJournalsDeletesOnly(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	b := NewBlocklist(rdb)
+	b.EnableJournal("us")
+	if err := b.Add(ctx, []BlockEntry{{Target: "1.2.3.4"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	before := rdb.XLen(ctx, blocklistChangesKey).Val()
+
+	n, err := b.Remove(ctx, []string{"1.2.3.4", "5.6.7.8"})
+	if err != nil || n != 1 {
+		t.Fatalf("Remove = %d, %v; want 1 removed", n, err)
+	}
+	if got := rdb.XLen(ctx, blocklistChangesKey).Val() - before; got != 1 {
+		t.Errorf("Remove journaled %d changes, want 1 for the entry that existed", got)
+	}
+	if rdb.HExists(ctx, blocklistVersionsKey, "5.6.7.8").Val() {
+		t.Error("target that was never blocked got a version")
+	}
+
+	// Removing it again is a no-op everywhere
+	before = rdb.XLen(ctx, blocklistChangesKey).Val()
+	if n, err := b.Remove(ctx, []string{"1.2.3.4"}); err != nil || n != 0 {
+		t.Fatalf("second Remove = %d, %v; want 0", n, err)
+	}
+	if got := rdb.XLen(ctx, blocklistChangesKey).Val() - before; got != 0 {
+		t.Errorf("second Remove journaled %d changes, want 0", got)
+	}
+}
+
+func TestBlocklistRegionMerge(t *testing.T) {
+	ctx := context.Background()
+	open := func(region string) *Blocklist {
+		rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		b := NewBlocklist(rdb)
+		b.EnableJournal(region)
+		return b
+	}
+	us, eu := open("us"), open("eu")
+
+	// Ban in us, then follow its change stream from eu
+	if err := us.Add(ctx, []BlockEntry{{Target: "1.2.3.4", Reason: "scanner"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	msgs, err := us.rdb.XRange(ctx, blocklistChangesKey, "-", "+").Result()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("change stream = %v, %v; want one change", msgs, err)
+	}
+	ban, err := changeFromMessage(msgs[0])
+	if err != nil {
+		t.Fatalf("changeFromMessage: %v", err)
+	}
+	if err := eu.apply(ctx, ban); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if e, ok := eu.Match("1.2.3.4"); !ok || e.Reason != "scanner" {
+		t.Fatalf("ban did not reach eu: %+v, %v", e, ok)
+	}
+
+	// A later unban in eu wins over the ban, and replaying the old ban doesn't undo it
+	time.Sleep(2 * time.Millisecond)
+	if _, err := eu.Remove(ctx, []string{"1.2.3.4"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	changes, err := snapshot(ctx, eu.rdb)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	for _, c := range changes {
+		if err := us.apply(ctx, c); err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+	}
+	if _, ok := us.Match("1.2.3.4"); ok {
+		t.Errorf("unban did not reach us")
+	}
+	if err := eu.apply(ctx, ban); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, ok := eu.Match("1.2.3.4"); ok {
+		t.Errorf("stale ban resurrected the entry")
+	}
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+	pb "github.com/shashank/intrusiondetection/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Canary failure kinds, also used as alert kinds
+const (
+	canaryBlocked = "canary_blocked" // The pipeline rejected a known-good request
+	canarySlow    = "canary_slow"    // The decision took longer than max_latency
+	canaryError   = "canary_error"   // The request never got a decision
+)
+
+// canaryTokenHeader carries the canary token on the canary's own streams
+const canaryTokenHeader = "x-canary-token"
+
+// CanaryConfig controls the built-in canary, which sends a known-good signed
+// request through the server's own gRPC listener on a schedule
+type CanaryConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Interval    Duration `json:"interval"`
+	IP          string   `json:"ip"`           // Source IP the canary reports; keep it off blocklists
+	SecretKey   string   `json:"secret_key"`   // Key the agents use; defaults to secret_key
+	PayloadSize int      `json:"payload_size"` // Bytes of payload per request
+	MaxLatency  Duration `json:"max_latency"`  // Slower decisions raise an alert
+}
+
+// DefaultCanaryConfig returns the canary settings used out of the box
+func DefaultCanaryConfig() CanaryConfig {
+	return CanaryConfig{
+		Enabled:     true,
+		Interval:    Duration(30 * time.Second),
+		IP:          "192.0.2.1", // TEST-NET-1, never a real agent
+		PayloadSize: 256,
+		MaxLatency:  Duration(250 * time.Millisecond),
+	}
+}
+
+// CanaryStatus is returned by GET /api/canary
+type CanaryStatus struct {
+	Enabled             bool    `json:"enabled"`
+	Healthy             bool    `json:"healthy"`
+	LastRun             int64   `json:"last_run,omitempty"` // Unix seconds
+	LatencyMs           float64 `json:"latency_ms"`
+	Status              string  `json:"status,omitempty"` // Decision the canary got
+	Failure             string  `json:"failure,omitempty"`
+	Message             string  `json:"message,omitempty"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+// Canary remembers the latest probe so failures are alerted once. Its
+// streams are told apart by a random token that never leaves the process,
+// not by the IP they report, which any agent could send.
+type Canary struct {
+	token string
+
+	mu     sync.Mutex
+	status CanaryStatus
+}
+
+// NewCanary returns a canary that has not run yet
+func NewCanary() *Canary {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("canary token: %v", err))
+	}
+	return &Canary{token: hex.EncodeToString(b), status: CanaryStatus{Healthy: true}}
+}
+
+// isProbe reports whether a stream was opened by this process's canary
+func (c *Canary) isProbe(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	tokens := md.Get(canaryTokenHeader)
+	return len(tokens) == 1 && subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(c.token)) == 1
+}
+
+// Status returns the result of the latest probe
+func (c *Canary) Status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// update stores a probe result and returns the previous status
+func (c *Canary) update(next CanaryStatus) CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.status
+	if next.Failure != "" {
+		next.ConsecutiveFailures = prev.ConsecutiveFailures + 1
+	}
+	c.status = next
+	return prev
+}
+
+// canaryTarget turns a listener address such as [::]:50051 into one the
+// canary can dial. A listener bound to a specific address is dialed there.
+func canaryTarget(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return addr.String()
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// startCanary probes target every interval while the canary is enabled.
+// Run starts it once the gRPC listener is up.
+func (s *Server) startCanary(ctx context.Context, target string) {
+	conn, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("Canary disabled: %v", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewIntrusionDetectionServiceClient(conn)
+	ctx = metadata.AppendToOutgoingContext(ctx, canaryTokenHeader, s.canary.token)
+
+	// A probe during warm-up would be refused
+	if s.WaitReady(ctx) != nil {
+		return
+	}
+
+	for {
+		cfg := s.config()
+		interval := time.Duration(cfg.Canary.Interval)
+		if cfg.Canary.Enabled {
+			s.runCanary(ctx, client, cfg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runCanary sends one probe and raises an alert when the outcome changes
+func (s *Server) runCanary(ctx context.Context, client pb.IntrusionDetectionServiceClient, cfg *Config) {
+	next := probeCanary(ctx, client, cfg)
+	if ctx.Err() != nil {
+		return
+	}
+	prev := s.canary.update(next)
+
+	switch {
+	case next.Failure != "" && next.Failure != prev.Failure:
+		severity := SeverityCritical
+		if next.Failure == canarySlow {
+			severity = SeverityWarning
+		}
+		s.raiseAlert(ctx, Alert{
+			Kind:     next.Failure,
+			Severity: severity,
+			Message:  "Canary: " + next.Message,
+			IP:       cfg.Canary.IP,
+			Details: map[string]any{
+				"status":     next.Status,
+				"latency_ms": next.LatencyMs,
+			},
+		})
+	case next.Failure == "" && prev.Failure != "":
+		s.raiseAlert(ctx, Alert{
+			Kind:     "canary_recovered",
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("Canary recovered after %d failed probes", prev.ConsecutiveFailures),
+			IP:       cfg.Canary.IP,
+		})
+	}
+}
+
+// probeCanary sends a single signed request on a fresh stream
+func probeCanary(ctx context.Context, client pb.IntrusionDetectionServiceClient, cfg *Config) CanaryStatus {
+	c := cfg.Canary
+	result := CanaryStatus{Enabled: true, LastRun: time.Now().Unix()}
+	fail := func(kind, format string, args ...any) CanaryStatus {
+		result.Failure = kind
+		result.Message = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	secret := c.SecretKey
+	if secret == "" {
+		secret = cfg.SecretKey
+	}
+	payload := []byte(strings.Repeat("canary ", c.PayloadSize/7+1))[:c.PayloadSize]
+
+	timeout := time.Duration(c.Interval)
+	if timeout > 10*time.Second {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	stream, err := client.StreamLogs(ctx)
+	if err != nil {
+		return fail(canaryError, "open stream: %v", err)
+	}
+	defer stream.CloseSend()
+
+	timestamp := time.Now().UnixNano()
+	if err := stream.Send(&pb.LogRequest{
+		IpAddress: c.IP,
+		Timestamp: timestamp,
+		Payload:   payload,
+		Signature: core.Sign(payload, timestamp, secret),
+	}); err != nil {
+		return fail(canaryError, "send: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return fail(canaryError, "receive: %v", err)
+	}
+	latency := time.Since(start)
+	result.LatencyMs = float64(latency.Microseconds()) / 1000
+	result.Status = resp.GetStatus()
+
+	// Monitor mode allows everything, but a would-be block is still a failure
+	if resp.GetDecision() != pb.Decision_DECISION_ALLOWED || resp.GetMonitor() {
+		return fail(canaryBlocked, "known-good request from %s was rejected: %s", c.IP, resp.GetMessage())
+	}
+	if latency > time.Duration(c.MaxLatency) {
+		return fail(canarySlow, "decision took %v, limit is %v", latency.Round(time.Millisecond), time.Duration(c.MaxLatency))
+	}
+	result.Healthy = true
+	return result
+}
+
+// canaryHandler serves GET /api/canary
+func (s *Server) canaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := s.canary.Status()
+	status.Enabled = s.config().Canary.Enabled
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	uniqueIPsKeyPrefix       = "uniqueips:" // HyperLogLog of source IPs per minute
+	velocityKeyPrefix        = "velocity:"  // Request count per minute
+	cardinalityAlertPrefix   = "cardinality_alert:"
+	cardinalityKeyTTL        = time.Hour
+	cardinalityFlushInterval = time.Second
+	cardinalitySettleDelay   = 3 * time.Second // Lets every server flush a minute before it is evaluated
+	cardinalitySamples       = 60              // Minutes kept for the API
+	pfaddBatchSize           = 1000
+)
+
+// CardinalityConfig tunes distributed attack detection. Per-IP limits miss
+// botnets where every IP stays under the limit, so this watches how many
+// distinct IPs are active per minute across all servers.
+type CardinalityConfig struct {
+	Enabled       bool    `json:"enabled"`
+	SpikeFactor   float64 `json:"spike_factor"`   // Alert above mean + SpikeFactor * stddev
+	MinUniqueIPs  int64   `json:"min_unique_ips"` // Never alert below this many unique IPs
+	WarmupMinutes int     `json:"warmup_minutes"` // Minutes of baseline learned before alerting
+	Smoothing     float64 `json:"smoothing"`      // EWMA weight of the newest minute, 0 < x <= 1
+}
+
+// DefaultCardinalityConfig returns the detection settings used out of the box
+func DefaultCardinalityConfig() CardinalityConfig {
+	return CardinalityConfig{
+		Enabled:       true,
+		SpikeFactor:   4,
+		MinUniqueIPs:  100,
+		WarmupMinutes: 10,
+		Smoothing:     0.1,
+	}
+}
+
+// MinuteSample is the global traffic seen in one minute
+type MinuteSample struct {
+	Minute    int64 `json:"minute"` // Unix seconds at the start of the minute
+	UniqueIPs int64 `json:"unique_ips"`
+	Requests  int64 `json:"requests"`
+	Spike     bool  `json:"spike"`
+}
+
+// CardinalitySnapshot is returned by GET /api/cardinality
+type CardinalitySnapshot struct {
+	BaselineMean   float64        `json:"baseline_mean"`
+	BaselineStdDev float64        `json:"baseline_stddev"`
+	LearnedMinutes int            `json:"learned_minutes"`
+	Samples        []MinuteSample `json:"samples"`
+}
+
+type pendingMinute struct {
+	ips      map[string]struct{}
+	requests int64
+}
+
+// CardinalityMonitor batches source IPs into per-minute HyperLogLogs in
+// Redis and learns a baseline of unique IPs per minute
+type CardinalityMonitor struct {
+	rdb redis.Cmdable
+
+	mu      sync.Mutex
+	pending map[int64]*pendingMinute // Keyed by minute, not yet flushed
+
+	// Baseline state, only touched by the evaluation loop and the API
+	statsMu sync.Mutex
+	mean    float64
+	vari    float64
+	learned int
+	samples []MinuteSample
+}
+
+// NewCardinalityMonitor returns a monitor writing to rdb
+func NewCardinalityMonitor(rdb redis.Cmdable) *CardinalityMonitor {
+	return &CardinalityMonitor{
+		rdb:     rdb,
+		pending: make(map[int64]*pendingMinute),
+	}
+}
+
+func minuteOf(t time.Time) int64 {
+	return t.Unix() / 60 * 60
+}
+
+// Record counts one request from ip
+func (m *CardinalityMonitor) Record(ip string, now time.Time) {
+	minute := minuteOf(now)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pending[minute]
+	if !ok {
+		p = &pendingMinute{ips: make(map[string]struct{})}
+		m.pending[minute] = p
+	}
+	p.ips[ip] = struct{}{}
+	p.requests++
+}
+
+// flush writes pending IPs and request counts to Redis
+func (m *CardinalityMonitor) flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[int64]*pendingMinute, 1)
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	pipe := m.rdb.Pipeline()
+	for minute, p := range pending {
+		hllKey := fmt.Sprintf("%s%d", uniqueIPsKeyPrefix, minute)
+		velocityKey := fmt.Sprintf("%s%d", velocityKeyPrefix, minute)
+
+		batch := make([]interface{}, 0, pfaddBatchSize)
+		for ip := range p.ips {
+			batch = append(batch, ip)
+			if len(batch) == pfaddBatchSize {
+				pipe.PFAdd(ctx, hllKey, batch...)
+				batch = make([]interface{}, 0, pfaddBatchSize)
+			}
+		}
+		if len(batch) > 0 {
+			pipe.PFAdd(ctx, hllKey, batch...)
+		}
+		pipe.Expire(ctx, hllKey, cardinalityKeyTTL)
+		pipe.IncrBy(ctx, velocityKey, p.requests)
+		pipe.Expire(ctx, velocityKey, cardinalityKeyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// sample reads the global counts for minute from Redis
+func (m *CardinalityMonitor) sample(ctx context.Context, minute int64) (MinuteSample, error) {
+	uniqueIPs, err := m.rdb.PFCount(ctx, fmt.Sprintf("%s%d", uniqueIPsKeyPrefix, minute)).Result()
+	if err != nil {
+		return MinuteSample{}, err
+	}
+	requests, err := m.rdb.Get(ctx, fmt.Sprintf("%s%d", velocityKeyPrefix, minute)).Int64()
+	if err != nil && err != redis.Nil {
+		return MinuteSample{}, err
+	}
+	return MinuteSample{Minute: minute, UniqueIPs: uniqueIPs, Requests: requests}, nil
+}
+
+// observe compares a completed minute against the baseline, then folds it
+// in. Spikes are kept out of the baseline so an attack doesn't become normal.
+func (m *CardinalityMonitor) observe(cfg CardinalityConfig, sample MinuteSample) (spike bool, mean, stddev float64) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	mean, stddev = m.mean, math.Sqrt(m.vari)
+	x := float64(sample.UniqueIPs)
+
+	if m.learned >= cfg.WarmupMinutes &&
+		sample.UniqueIPs >= cfg.MinUniqueIPs &&
+		x > mean+cfg.SpikeFactor*stddev {
+		spike = true
+	}
+
+	if !spike {
+		if m.learned == 0 {
+			m.mean = x
+		} else {
+			// Exponentially weighted mean and variance
+			diff := x - m.mean
+			incr := cfg.Smoothing * diff
+			m.mean += incr
+			m.vari = (1 - cfg.Smoothing) * (m.vari + diff*incr)
+		}
+		m.learned++
+	}
+
+	sample.Spike = spike
+	m.samples = append(m.samples, sample)
+	if len(m.samples) > cardinalitySamples {
+		m.samples = m.samples[len(m.samples)-cardinalitySamples:]
+	}
+	return spike, mean, stddev
+}
+
+// Snapshot returns the baseline and recent samples
+func (m *CardinalityMonitor) Snapshot() CardinalitySnapshot {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	return CardinalitySnapshot{
+		BaselineMean:   m.mean,
+		BaselineStdDev: math.Sqrt(m.vari),
+		LearnedMinutes: m.learned,
+		Samples:        append([]MinuteSample(nil), m.samples...),
+	}
+}
+
+// RecentSpike reports whether the latest evaluated minute was a spike. It
+// stays true until the next minute is evaluated.
+func (m *CardinalityMonitor) RecentSpike(now time.Time) bool {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	if len(m.samples) == 0 {
+		return false
+	}
+	last := m.samples[len(m.samples)-1]
+	return last.Spike && last.Minute >= minuteOf(now)-2*60
+}
+
+// startCardinalityMonitor flushes IPs every second and evaluates each
+// completed minute. Only one server raises the alert for a given minute.
+func (s *Server) startCardinalityMonitor(ctx context.Context) {
+	flushTicker := time.NewTicker(cardinalityFlushInterval)
+	defer flushTicker.Stop()
+
+	lastEvaluated := minuteOf(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-flushTicker.C:
+			if err := s.cardinality.flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Cardinality flush error: %v", err)
+			}
+
+			// Evaluate the previous minute once every server has had time to flush it
+			previous := minuteOf(now.Add(-cardinalitySettleDelay)) - 60
+			if previous <= lastEvaluated {
+				continue
+			}
+			lastEvaluated = previous
+			s.evaluateCardinality(ctx, previous)
+		}
+	}
+}
+
+func (s *Server) evaluateCardinality(ctx context.Context, minute int64) {
+	cfg := s.config().Cardinality
+	if !cfg.Enabled {
+		return
+	}
+
+	sample, err := s.cardinality.sample(ctx, minute)
+	if err != nil {
+		log.Printf("Cardinality sample error: %v", err)
+		return
+	}
+
+	spike, mean, stddev := s.cardinality.observe(cfg, sample)
+	if !spike {
+		return
+	}
+
+	// Every server sees the same global counts; let the first one alert
+	key := fmt.Sprintf("%s%d", cardinalityAlertPrefix, minute)
+	if first, err := s.rdb.SetNX(ctx, key, 1, 2*time.Minute).Result(); err != nil || !first {
+		return
+	}
+
+	perIP := float64(sample.Requests) / float64(sample.UniqueIPs)
+	s.raiseAlert(ctx, Alert{
+		Kind:     "cardinality_spike",
+		Severity: SeverityCritical,
+		Message: fmt.Sprintf("Possible distributed attack: %d unique IPs in one minute (baseline %.0f ± %.0f)",
+			sample.UniqueIPs, mean, stddev),
+		Details: map[string]any{
+			"minute":          sample.Minute,
+			"unique_ips":      sample.UniqueIPs,
+			"requests":        sample.Requests,
+			"requests_per_ip": perIP,
+			"baseline_mean":   mean,
+			"baseline_stddev": stddev,
+		},
+	})
+}
+
+// cardinalityHandler serves GET /api/cardinality
+func (s *Server) cardinalityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.cardinality.Snapshot())
+}
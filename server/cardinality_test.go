@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCardinalitySpikeAlert(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := DefaultConfig()
+	cfg.RedisAddr = mr.Addr()
+	cfg.Cardinality = CardinalityConfig{Enabled: true, SpikeFactor: 4, MinUniqueIPs: 50, WarmupMinutes: 3, Smoothing: 0.5}
+
+	// Two servers share Redis, so each minute's count covers both of them
+	var servers [2]*Server
+	for i := range servers {
+		s, err := NewServer(cfg)
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		servers[i] = s
+	}
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0).Truncate(time.Minute)
+
+	// record spreads n IPs of one minute across both servers and evaluates it
+	record := func(minute, n int) {
+		t.Helper()
+		at := start.Add(time.Duration(minute) * time.Minute)
+		for i := 0; i < n; i++ {
+			servers[i%2].cardinality.Record(fmt.Sprintf("10.%d.%d.%d", minute, i/256, i%256), at)
+		}
+		for _, s := range servers {
+			if err := s.cardinality.flush(ctx); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+		}
+		for _, s := range servers {
+			s.evaluateCardinality(ctx, minuteOf(at))
+		}
+	}
+	spikes := func() int {
+		t.Helper()
+		page, err := QueryAlerts(ctx, servers[0].rdb, AlertQuery{Kinds: []string{"cardinality_spike"}})
+		if err != nil {
+			t.Fatalf("QueryAlerts: %v", err)
+		}
+		return len(page.Alerts)
+	}
+
+	// A busy minute during warm-up is learned, not alerted on
+	record(0, 20)
+	record(1, 200)
+	record(2, 20)
+	if n := spikes(); n != 0 {
+		t.Fatalf("%d spike alerts during warm-up, want none", n)
+	}
+	snap := servers[0].cardinality.Snapshot()
+	if snap.LearnedMinutes != 3 || snap.Samples[1].UniqueIPs != 200 {
+		t.Fatalf("snapshot after warm-up = %+v, want 3 learned minutes with the cluster-wide counts", snap)
+	}
+
+	record(3, 20)
+	record(4, 20)
+	if n := spikes(); n != 0 {
+		t.Fatalf("%d spike alerts for normal traffic, want none", n)
+	}
+
+	record(5, 2000)
+	if n := spikes(); n != 1 {
+		t.Fatalf("%d spike alerts for 2000 IPs, want one for the whole cluster", n)
+	}
+	for _, s := range servers {
+		if !s.cardinality.RecentSpike(start.Add(5 * time.Minute)) {
+			t.Errorf("server does not report the spike")
+		}
+	}
+
+	// The spike stays out of the baseline
+	if mean := servers[0].cardinality.Snapshot().BaselineMean; mean > 200 {
+		t.Errorf("baseline mean = %.0f after the spike, want it unchanged by it", mean)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultFaultDuration = 5 * time.Minute
+	maxFaultDuration     = time.Hour
+	maxFaultDelay        = time.Minute
+)
+
+// ErrInjectedFault is returned by Redis commands failed on purpose
+var ErrInjectedFault = errors.New("injected fault")
+
+// Faults are failures injected into the server's dependencies to rehearse
+// degraded operation. They clear themselves after Duration.
+type Faults struct {
+	RedisLatency   Duration `json:"redis_latency,omitempty"`    // Added to every Redis command
+	RedisErrorRate float64  `json:"redis_error_rate,omitempty"` // Share of Redis commands failed with ErrInjectedFault
+	AIWorkerDelay  Duration `json:"ai_worker_delay,omitempty"`  // Held before handling each AI worker alert
+	WebSocketStall Duration `json:"websocket_stall,omitempty"`  // Held before each write to a dashboard client
+	Duration       Duration `json:"duration,omitempty"`         // How long the faults last; 5m if unset
+	ExpiresAt      int64    `json:"expires_at,omitempty"`       // Unix seconds, set by the server
+}
+
+func (f Faults) validate() error {
+	for name, d := range map[string]Duration{"redis_latency": f.RedisLatency, "ai_worker_delay": f.AIWorkerDelay, "websocket_stall": f.WebSocketStall} {
+		if d < 0 || time.Duration(d) > maxFaultDelay {
+			return fmt.Errorf("%s must be between 0 and %v", name, maxFaultDelay)
+		}
+	}
+	if f.RedisErrorRate < 0 || f.RedisErrorRate > 1 {
+		return errors.New("redis_error_rate must be in [0, 1]")
+	}
+	if f.Duration < 0 || time.Duration(f.Duration) > maxFaultDuration {
+		return fmt.Errorf("duration must be between 0 and %v", maxFaultDuration)
+	}
+	return nil
+}
+
+// Chaos holds the injected faults. The zero value injects nothing.
+type Chaos struct {
+	faults atomic.Pointer[Faults]
+}
+
+// Active returns the faults in force, or zero Faults when there are none
+func (c *Chaos) Active() Faults {
+	f := c.faults.Load()
+	if f == nil || time.Now().Unix() >= f.ExpiresAt {
+		return Faults{}
+	}
+	return *f
+}
+
+// Set replaces the injected faults, starting their duration now
+func (c *Chaos) Set(f Faults) (Faults, error) {
+	if err := f.validate(); err != nil {
+		return Faults{}, err
+	}
+	if f.Duration == 0 {
+		f.Duration = Duration(defaultFaultDuration)
+	}
+	f.ExpiresAt = time.Now().Add(time.Duration(f.Duration)).Unix()
+	c.faults.Store(&f)
+	return f, nil
+}
+
+// Clear stops injecting faults
+func (c *Chaos) Clear() {
+	c.faults.Store(nil)
+}
+
+// sleepContext sleeps for d unless ctx ends first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// redisFault applies the Redis latency and picks whether a command fails
+func (c *Chaos) redisFault(ctx context.Context) error {
+	f := c.Active()
+	if err := sleepContext(ctx, time.Duration(f.RedisLatency)); err != nil {
+		return err
+	}
+	if f.RedisErrorRate > 0 && rand.Float64() < f.RedisErrorRate {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// chaosHook injects Redis faults into every command sent by a client
+type chaosHook struct {
+	chaos *Chaos
+}
+
+func (h chaosHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h chaosHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.chaos.redisFault(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h chaosHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.chaos.redisFault(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// chaosHandler serves GET, PUT and DELETE /api/chaos. Faults can only be
+// set when the config allows them.
+func (s *Server) chaosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.chaos.Active())
+	case http.MethodPut, http.MethodPost:
+		if !s.config().AllowFaults {
+			http.Error(w, "fault injection is disabled (allow_faults is off)", http.StatusForbidden)
+			return
+		}
+		var req Faults
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		faults, err := s.chaos.Set(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Fault injection on for %v: %+v", time.Duration(faults.Duration), faults)
+		writeJSON(w, http.StatusOK, faults)
+	case http.MethodDelete:
+		s.chaos.Clear()
+		log.Printf("Fault injection cleared")
+		writeJSON(w, http.StatusOK, Faults{})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
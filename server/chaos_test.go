@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChaosFaults(t *testing.T) {
+	var c Chaos
+	ctx := context.Background()
+
+	if err := c.redisFault(ctx); err != nil {
+		t.Fatalf("no faults set: got %v", err)
+	}
+	if _, err := c.Set(Faults{RedisErrorRate: 2}); err == nil {
+		t.Error("error rate above 1 was accepted")
+	}
+	if _, err := c.Set(Faults{RedisLatency: Duration(2 * time.Minute)}); err == nil {
+		t.Error("latency above the maximum was accepted")
+	}
+
+	f, err := c.Set(Faults{RedisErrorRate: 1})
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if time.Duration(f.Duration) != defaultFaultDuration || f.ExpiresAt <= time.Now().Unix() {
+		t.Errorf("Set = %+v, want the default duration and an expiry", f)
+	}
+	if err := c.redisFault(ctx); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("error rate 1: got %v, want ErrInjectedFault", err)
+	}
+
+	// Expired faults stop applying
+	expired := f
+	expired.ExpiresAt = time.Now().Unix() - 1
+	c.faults.Store(&expired)
+	if got := c.Active(); got.RedisErrorRate != 0 {
+		t.Errorf("expired faults still active: %+v", got)
+	}
+
+	c.Set(Faults{RedisLatency: Duration(time.Second)})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.redisFault(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("latency with a cancelled context: got %v", err)
+	}
+}
+
+func TestWebSocketStallDoesNotHoldBroadcaster(t *testing.T) {
+	h := NewWebSocketHub()
+	h.chaos = &Chaos{}
+	conn := dialHub(t, h)
+	stall := 300 * time.Millisecond
+	if _, err := h.chaos.Set(Faults{WebSocketStall: Duration(stall)}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// The stats loop broadcasts and goes on counting; only the client waits
+	start := time.Now()
+	h.BroadcastRaw([]byte("{}"))
+	if waited := time.Since(start); waited > stall/3 {
+		t.Errorf("broadcast waited %v behind a stalled client", waited)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := time.Since(start); got < stall {
+		t.Errorf("message arrived after %v, want the %v stall", got, stall)
+	}
+
+	// Removing a client ends its stall at once
+	h.BroadcastRaw([]byte("{}"))
+	start = time.Now()
+	h.Close()
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("closed client still got a message")
+	}
+	if waited := time.Since(start); waited > stall/3 {
+		t.Errorf("close waited %v for the stall", waited)
+	}
+}
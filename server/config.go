@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+)
+
+const (
+	trafficMonitorCh = "traffic_monitor" // Redis Pub/Sub channel for AI worker
+	aiAlertsCh       = "ai_alerts"       // Redis Pub/Sub channel for AI alerts
+)
+
+// Duration is a time.Duration that reads and writes as a string ("10s") in JSON
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// InspectionConfig is the JSON form of core.Rules
+type InspectionConfig struct {
+	MaxPayloadSize int      `json:"max_payload_size"`
+	MaxClockSkew   Duration `json:"max_clock_skew"`
+	DenyPatterns   []string `json:"deny_patterns"`
+}
+
+// Rules converts the config into core inspection rules
+func (c InspectionConfig) Rules() core.Rules {
+	rules := core.Rules{
+		MaxPayloadSize: c.MaxPayloadSize,
+		MaxClockSkew:   time.Duration(c.MaxClockSkew),
+	}
+	for _, p := range c.DenyPatterns {
+		rules.DenyPatterns = append(rules.DenyPatterns, []byte(p))
+	}
+	return rules
+}
+
+// Enforcement modes
+const (
+	ModeEnforce = "enforce" // Blocked requests get a BLOCKED_* status
+	ModeMonitor = "monitor" // Decisions are counted and logged but every request is allowed
+)
+
+// Config holds everything needed to run a Server
+type Config struct {
+	Path string `json:"-"` // File the config was loaded from, re-read by Reload
+
+	GRPCAddr       string `json:"grpc_addr"`
+	HTTPAddr       string `json:"http_addr"`
+	AdminAddr      string `json:"admin_addr"`      // Empty disables the admin server
+	AdminToken     string `json:"admin_token"`     // Bearer token required by the admin server
+	ManagementAddr string `json:"management_addr"` // gRPC ManagementService; also needs admin_token, empty disables it
+	SecretKey      string `json:"secret_key"`      // HMAC key shared with agents
+	RedisAddr      string `json:"redis_addr"`
+	Mode           string `json:"mode"` // enforce (default) or monitor
+
+	RateLimit       int      `json:"rate_limit"`        // max requests
+	RateLimitWindow Duration `json:"rate_limit_window"` // per window
+	LocalBlockTTL   Duration `json:"local_block_ttl"`   // L1 cache TTL for blocked IPs
+
+	AllowCache AllowCacheConfig `json:"allow_cache"` // L1 cache of allow decisions for busy IPs
+
+	HTTP HTTPConfig `json:"http"` // Origins, security headers and TLS for the HTTP and admin listeners
+
+	HistorySize int `json:"history_size"` // Recent requests per IP attached to alerts, 0 disables
+
+	Inspection  InspectionConfig  `json:"inspection"`
+	Cardinality CardinalityConfig `json:"cardinality"`
+	UnderAttack AttackConfig      `json:"under_attack"`
+	Replay      ReplayConfig      `json:"replay"`
+	Events      EventLogConfig    `json:"events"`
+	Privacy     PrivacyConfig     `json:"privacy"`
+	Canary      CanaryConfig      `json:"canary"`
+	Warmup      WarmupConfig      `json:"warmup"`
+	Geo         GeoConfig         `json:"geo"`      // Traffic by country and ASN
+	Queue       QueueConfig       `json:"queue"`    // Disk buffer for events and alerts during Redis outages
+	Baseline    BaselineConfig    `json:"baseline"` // Learned normal traffic per hour of day
+
+	AlertSinks   []AlertSink        `json:"alert_sinks"` // Where alerts raised by this server are forwarded
+	AlertHistory AlertHistoryConfig `json:"alert_history"`
+
+	BlocklistFeeds []BlocklistFeed  `json:"blocklist_feeds"`
+	Regions        RegionSyncConfig `json:"regions"` // Blocklist sync with other regions' Redis
+
+	// Response to each check that matches, keyed by check name. Checks not
+	// listed block.
+	Actions map[string]ActionConfig `json:"actions"`
+
+	AllowFaults bool `json:"allow_faults"` // Allow fault injection through the admin API; keep off in production
+}
+
+// DefaultConfig returns the settings used when no config file is given
+func DefaultConfig() Config {
+	rules := core.DefaultRules()
+	return Config{
+		GRPCAddr:        ":50051",
+		HTTPAddr:        ":8080",
+		AdminAddr:       ":6060",
+		ManagementAddr:  ":50052",
+		SecretKey:       "my-super-secret-key",
+		RedisAddr:       "localhost:6379",
+		Mode:            ModeEnforce,
+		RateLimit:       100,
+		RateLimitWindow: Duration(10 * time.Second),
+		LocalBlockTTL:   Duration(60 * time.Second),
+		AllowCache:      DefaultAllowCacheConfig(),
+		HTTP:            DefaultHTTPConfig(),
+		HistorySize:     20,
+		Inspection: InspectionConfig{
+			MaxPayloadSize: rules.MaxPayloadSize,
+			MaxClockSkew:   Duration(rules.MaxClockSkew),
+		},
+		Cardinality: DefaultCardinalityConfig(),
+		UnderAttack: DefaultAttackConfig(),
+		Replay:      DefaultReplayConfig(),
+		Events:      DefaultEventLogConfig(),
+		Privacy:     DefaultPrivacyConfig(),
+		Canary:      DefaultCanaryConfig(),
+		Warmup:      DefaultWarmupConfig(),
+		Geo:         DefaultGeoConfig(),
+		Queue:       DefaultQueueConfig(),
+		Baseline:    DefaultBaselineConfig(),
+
+		AlertHistory: DefaultAlertHistoryConfig(),
+		Regions:      DefaultRegionSyncConfig(),
+	}
+}
+
+// LoadConfig reads a JSON config file. Fields missing from the file keep their defaults.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	cfg.Path = path
+	return cfg, cfg.Validate()
+}
+
+// clone returns a copy of c that shares no maps or slices with it, so JSON can
+// be decoded over the copy without changing c
+func (c Config) clone() Config {
+	c.HTTP.AllowedOrigins = slices.Clone(c.HTTP.AllowedOrigins)
+	c.Inspection.DenyPatterns = slices.Clone(c.Inspection.DenyPatterns)
+	c.UnderAttack.Actions = maps.Clone(c.UnderAttack.Actions)
+	c.AlertSinks = slices.Clone(c.AlertSinks)
+	c.BlocklistFeeds = slices.Clone(c.BlocklistFeeds)
+	c.Regions.Peers = slices.Clone(c.Regions.Peers)
+	c.Actions = maps.Clone(c.Actions)
+	return c
+}
+
+// Validate reports settings the server cannot run with
+func (c Config) Validate() error {
+	if c.GRPCAddr == "" || c.HTTPAddr == "" {
+		return errors.New("grpc_addr and http_addr are required")
+	}
+	if c.SecretKey == "" {
+		return errors.New("secret_key is required")
+	}
+	if c.Mode != "" && c.Mode != ModeEnforce && c.Mode != ModeMonitor {
+		return fmt.Errorf("mode must be %q or %q", ModeEnforce, ModeMonitor)
+	}
+	if c.RateLimit <= 0 || c.RateLimitWindow <= 0 {
+		return errors.New("rate_limit and rate_limit_window must be positive")
+	}
+	if err := c.AllowCache.validate(); err != nil {
+		return err
+	}
+	if err := c.HTTP.validate(); err != nil {
+		return err
+	}
+	if c.HistorySize < 0 {
+		return errors.New("history_size must not be negative")
+	}
+	if c.Cardinality.Enabled && (c.Cardinality.Smoothing <= 0 || c.Cardinality.Smoothing > 1 || c.Cardinality.SpikeFactor <= 0) {
+		return errors.New("cardinality smoothing must be in (0, 1] and spike_factor positive")
+	}
+	if a := c.UnderAttack; a.Enabled && (a.RPSFactor <= 1 || a.BlockRatio <= 0 || a.BlockRatio > 1 || a.MinSignals < 1 || a.MinSignals > 3) {
+		return errors.New("under_attack needs rps_factor above 1, block_ratio in (0, 1] and min_signals from 1 to 3")
+	}
+	if f := c.UnderAttack.RateLimitFactor; f <= 0 || f > 1 {
+		return errors.New("under_attack rate_limit_factor must be in (0, 1]")
+	}
+	if c.Replay.Enabled && (c.Replay.Window <= 0 || c.Replay.MinIPs < 2) {
+		return errors.New("replay window must be positive and min_ips at least 2")
+	}
+	if c.Events.Enabled && c.Events.MaxLen <= 0 {
+		return errors.New("events max_len must be positive")
+	}
+	if c.AlertHistory.Enabled && c.AlertHistory.MaxLen <= 0 {
+		return errors.New("alert_history max_len must be positive")
+	}
+	if err := c.Privacy.validate(); err != nil {
+		return err
+	}
+	if c.Canary.Interval <= 0 || c.Canary.PayloadSize < 0 {
+		return errors.New("canary interval must be positive and payload_size not negative")
+	}
+	if _, err := netip.ParseAddr(c.Canary.IP); c.Canary.Enabled && err != nil {
+		return fmt.Errorf("canary ip: %w", err)
+	}
+	if err := c.Warmup.validate(); err != nil {
+		return err
+	}
+	if err := c.Geo.validate(); err != nil {
+		return err
+	}
+	if err := c.Queue.validate(); err != nil {
+		return err
+	}
+	if err := c.Baseline.validate(); err != nil {
+		return err
+	}
+	if err := validateActions(c.Actions); err != nil {
+		return err
+	}
+	if err := validateActions(c.UnderAttack.Actions); err != nil {
+		return fmt.Errorf("under_attack: %w", err)
+	}
+	for _, sink := range c.AlertSinks {
+		if err := sink.validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Regions.validate(); err != nil {
+		return err
+	}
+	for _, feed := range c.BlocklistFeeds {
+		if feed.Source == "" || !validFormat(feed.Format) {
+			return fmt.Errorf("blocklist feed %q: source and a format of text, csv or ipset are required", feed.Source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	queueSegmentExt     = ".seg"
+	queueDrainInterval  = time.Second
+	queueDrainBatch     = 500
+	queueKindEvent      = "event" // Traffic event for the events stream
+	queueKindAlert      = "alert" // Encoded alert for the alert history
+	defaultQueueMax     = 256 << 20
+	defaultQueueSegment = 8 << 20
+)
+
+// QueueConfig controls the disk queue that holds traffic events and alerts
+// while Redis can't be written to
+type QueueConfig struct {
+	Dir          string `json:"dir"`           // Empty disables the queue: writes that fail are dropped
+	MaxBytes     int64  `json:"max_bytes"`     // Oldest segments are dropped beyond this
+	SegmentBytes int64  `json:"segment_bytes"` // A new segment is started at this size
+}
+
+// DefaultQueueConfig returns the queue settings used out of the box
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		MaxBytes:     defaultQueueMax,
+		SegmentBytes: defaultQueueSegment,
+	}
+}
+
+func (c QueueConfig) validate() error {
+	if c.Dir != "" && (c.SegmentBytes <= 0 || c.MaxBytes < c.SegmentBytes) {
+		return errors.New("queue segment_bytes must be positive and max_bytes at least segment_bytes")
+	}
+	return nil
+}
+
+// queueRecord is one line of a segment
+type queueRecord struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+type queueSegment struct {
+	seq     uint64
+	size    int64
+	records int64
+}
+
+// DiskQueue is a write-ahead queue of append-only segment files. Records are
+// appended to the newest segment and drained from the oldest; a segment is
+// deleted once every record in it was delivered. Delivery is at least once:
+// a segment drained partway before a restart is sent again from its start.
+type DiskQueue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu       sync.Mutex
+	segments []*queueSegment // Oldest first; the last one is written to
+	w        *os.File
+	size     int64
+	readOff  int64 // Bytes of segments[0] already delivered
+	readRecs int64 // Records of segments[0] already delivered
+
+	pending atomic.Int64 // Records waiting to be delivered
+	dropped atomic.Int64 // Records deleted by the size cap
+}
+
+// OpenDiskQueue opens the queue in dir, creating it if needed, and picks up
+// segments left by a previous process
+func OpenDiskQueue(dir string, maxBytes, segmentBytes int64) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+queueSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), queueSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := q.scan(seq)
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seg)
+		q.size += seg.size
+		q.pending.Add(seg.records)
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+
+	var next uint64 = 1
+	if n := len(q.segments); n > 0 {
+		next = q.segments[n-1].seq + 1
+	}
+	if err := q.startSegment(next); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueSegmentExt))
+}
+
+// scan counts the complete records of a segment left on disk
+func (q *DiskQueue) scan(seq uint64) (*queueSegment, error) {
+	f, err := os.Open(q.path(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seg := &queueSegment{seq: seq}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		seg.size += int64(len(line))
+		if err == io.EOF {
+			return seg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		seg.records++
+	}
+}
+
+// startSegment opens a new segment for writing. Callers hold q.mu or own q.
+func (q *DiskQueue) startSegment(seq uint64) error {
+	f, err := os.OpenFile(q.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if q.w != nil {
+		q.w.Close()
+	}
+	q.w = f
+	q.segments = append(q.segments, &queueSegment{seq: seq})
+	return nil
+}
+
+// Append writes records to the newest segment, starting a new one when it
+// is full and dropping the oldest segments to stay under the size cap
+func (q *DiskQueue) Append(records []queueRecord) error {
+	var buf []byte
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.w == nil {
+		return errors.New("disk queue is closed")
+	}
+	if _, err := q.w.Write(buf); err != nil {
+		return err
+	}
+	cur := q.segments[len(q.segments)-1]
+	cur.size += int64(len(buf))
+	cur.records += int64(len(records))
+	q.size += int64(len(buf))
+	q.pending.Add(int64(len(records)))
+
+	if cur.size >= q.segmentBytes {
+		if err := q.startSegment(cur.seq + 1); err != nil {
+			return err
+		}
+	}
+	for q.size > q.maxBytes && len(q.segments) > 1 {
+		q.dropOldest()
+	}
+	return nil
+}
+
+// dropOldest deletes the oldest segment with whatever it has not delivered.
+// Callers hold q.mu.
+func (q *DiskQueue) dropOldest() {
+	seg := q.segments[0]
+	os.Remove(q.path(seg.seq))
+	lost := seg.records - q.readRecs
+	q.dropped.Add(lost)
+	q.pending.Add(-lost)
+	q.size -= seg.size
+	q.segments = q.segments[1:]
+	q.readOff, q.readRecs = 0, 0
+}
+
+// Len returns the number of records waiting to be delivered
+func (q *DiskQueue) Len() int64 {
+	return q.pending.Load()
+}
+
+// Bytes returns the size of the queue on disk
+func (q *DiskQueue) Bytes() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Dropped returns the number of records lost to the size cap
+func (q *DiskQueue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// Drain delivers records oldest first in batches through send, deleting each
+// segment once it is done. It stops at the first error, and the next Drain
+// resumes from the batch that failed.
+func (q *DiskQueue) Drain(send func([]queueRecord) error) (int64, error) {
+	var delivered int64
+	for {
+		q.mu.Lock()
+		if q.w == nil || q.pending.Load() == 0 {
+			q.mu.Unlock()
+			return delivered, nil
+		}
+		seg := q.segments[0]
+		if len(q.segments) == 1 {
+			// Seal the segment being written so it can be read to the end
+			if err := q.startSegment(seg.seq + 1); err != nil {
+				q.mu.Unlock()
+				return delivered, err
+			}
+		}
+		off := q.readOff
+		q.mu.Unlock()
+
+		n, err := q.drainSegment(seg, off, send)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+
+		q.mu.Lock()
+		if len(q.segments) > 0 && q.segments[0] == seg {
+			os.Remove(q.path(seg.seq))
+			q.size -= seg.size
+			q.segments = q.segments[1:]
+			q.readOff, q.readRecs = 0, 0
+		}
+		q.mu.Unlock()
+	}
+}
+
+// drainSegment sends the records of a sealed segment from off to its end
+func (q *DiskQueue) drainSegment(seg *queueSegment, off int64, send func([]queueRecord) error) (int64, error) {
+	f, err := os.Open(q.path(seg.seq))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil // Dropped by the size cap meanwhile
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var delivered int64
+	r := bufio.NewReader(f)
+	batch := make([]queueRecord, 0, queueDrainBatch)
+	var batchBytes, batchLines int64
+	flush := func() error {
+		if batchLines == 0 {
+			return nil
+		}
+		if err := send(batch); err != nil {
+			return err
+		}
+		q.mu.Lock()
+		if len(q.segments) > 0 && q.segments[0] == seg {
+			q.readOff += batchBytes
+			q.readRecs += batchLines
+			q.pending.Add(-batchLines)
+		}
+		q.mu.Unlock()
+		delivered += int64(len(batch))
+		batch, batchBytes, batchLines = batch[:0], 0, 0
+		return nil
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial last line is a write cut short by a crash
+			return delivered, flush()
+		}
+		if err != nil {
+			return delivered, err
+		}
+		batchBytes += int64(len(line))
+		batchLines++
+		var rec queueRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("Disk queue: skipping unreadable record in segment %d: %v", seg.seq, err)
+		} else {
+			batch = append(batch, rec)
+		}
+		if batchLines == queueDrainBatch {
+			if err := flush(); err != nil {
+				return delivered, err
+			}
+		}
+	}
+}
+
+// Close closes the segment being written. Queued records stay on disk for
+// the next process.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.w == nil {
+		return nil
+	}
+	err := q.w.Close()
+	q.w = nil
+	return err
+}
+
+// spool queues records that could not be written to Redis. Without a disk
+// queue they are counted as lost.
+func (s *Server) spool(kind string, data []json.RawMessage) {
+	if s.queue == nil {
+		s.stats.lostWrites.Add(int64(len(data)))
+		return
+	}
+	records := make([]queueRecord, len(data))
+	for i, d := range data {
+		records[i] = queueRecord{Kind: kind, Data: d}
+	}
+	if err := s.queue.Append(records); err != nil {
+		log.Printf("Disk queue write error: %v", err)
+		s.stats.lostWrites.Add(int64(len(data)))
+	}
+}
+
+// startQueueDrain delivers queued records once Redis takes writes again
+func (s *Server) startQueueDrain(ctx context.Context) {
+	ticker := time.NewTicker(queueDrainInterval)
+	defer ticker.Stop()
+
+	var dropped int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if d := s.queue.Dropped(); d > dropped {
+			log.Printf("Disk queue: size cap dropped %d records", d-dropped)
+			dropped = d
+		}
+		if s.queue.Len() == 0 {
+			continue
+		}
+		n, err := s.queue.Drain(func(records []queueRecord) error {
+			return s.deliverQueued(ctx, records)
+		})
+		if n > 0 {
+			log.Printf("Disk queue: delivered %d records, %d left", n, s.queue.Len())
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Disk queue drain paused: %v", err)
+		}
+	}
+}
+
+// queuedXAddScript adds a queued record to a stream with an ID from the time
+// it was recorded, so time-range queries and the retention purge, which go by
+// stream ID, treat it by its own time. IDs only grow, so a record older than
+// the newest entry takes the next ID after it, and if Redis still refuses the
+// ID (a purge removed newer entries) the record gets a fresh one.
+// ARGV: max length, Unix milliseconds, then field/value pairs.
+var queuedXAddScript = redis.NewScript(`
+	local ms, seq = tonumber(ARGV[2]), 0
+	local top = redis.call('XREVRANGE', KEYS[1], '+', '-', 'COUNT', 1)[1]
+	if top then
+		local topMs, topSeq = string.match(top[1], '^(%d+)-(%d+)$')
+		topMs, topSeq = tonumber(topMs), tonumber(topSeq)
+		if ms <= topMs then
+			ms, seq = topMs, topSeq + 1
+		end
+	end
+
+	local id = redis.pcall('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], string.format('%d-%d', ms, seq), unpack(ARGV, 3))
+	if type(id) == 'table' and id.err then
+		id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', unpack(ARGV, 3))
+	end
+	return id
+`)
+
+// deliverQueued writes a batch of queued records to Redis in one pipeline
+func (s *Server) deliverQueued(ctx context.Context, records []queueRecord) error {
+	cfg := s.config()
+	if err := queuedXAddScript.Load(ctx, s.rdb).Err(); err != nil {
+		return err
+	}
+	pipe := s.rdb.Pipeline()
+	for _, rec := range records {
+		switch rec.Kind {
+		case queueKindEvent:
+			var e Event
+			if err := json.Unmarshal(rec.Data, &e); err != nil {
+				continue
+			}
+			args := []interface{}{cfg.Events.MaxLen, e.ReceivedAt}
+			for field, v := range e.values() {
+				args = append(args, field, v)
+			}
+			queuedXAddScript.EvalSha(ctx, pipe, []string{eventsStreamKey}, args...)
+		case queueKindAlert:
+			var a Alert
+			if err := json.Unmarshal(rec.Data, &a); err != nil {
+				continue
+			}
+			queuedXAddScript.EvalSha(ctx, pipe, []string{alertsStreamKey}, cfg.AlertHistory.MaxLen, a.Timestamp*1000, "alert", []byte(rec.Data))
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
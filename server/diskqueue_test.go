@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func queueRecords(from, n int) []queueRecord {
+	records := make([]queueRecord, n)
+	for i := range records {
+		records[i] = queueRecord{Kind: queueKindAlert, Data: json.RawMessage(fmt.Sprintf(`{"n":%d}`, from+i))}
+	}
+	return records
+}
+
+func TestDiskQueueDrainResumes(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, 1<<20, 256)
+	if err != nil {
+		t.Fatalf("OpenDiskQueue: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := q.Append(queueRecords(i*10, 10)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if q.Len() != 100 {
+		t.Fatalf("Len = %d, want 100", q.Len())
+	}
+
+	// The first drain fails after two batches; nothing already sent is repeated
+	var got []string
+	calls := 0
+	send := func(records []queueRecord) error {
+		calls++
+		if calls == 3 {
+			return errors.New("redis down")
+		}
+		for _, r := range records {
+			got = append(got, string(r.Data))
+		}
+		return nil
+	}
+	if _, err := q.Drain(send); err == nil {
+		t.Fatal("Drain did not report the failed send")
+	}
+	if _, err := q.Drain(send); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if len(got) != 100 || got[0] != `{"n":0}` || got[99] != `{"n":99}` {
+		t.Fatalf("delivered %d records (%v...), want 100 in order", len(got), got[:min(3, len(got))])
+	}
+	if q.Len() != 0 || q.Bytes() != 0 {
+		t.Errorf("after drain Len = %d, Bytes = %d; want empty", q.Len(), q.Bytes())
+	}
+}
+
+func TestDiskQueueSizeCapAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, 1024, 256)
+	if err != nil {
+		t.Fatalf("OpenDiskQueue: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := q.Append(queueRecords(i*5, 5)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if q.Bytes() > 1024 {
+		t.Errorf("Bytes = %d, want at most the 1024 cap", q.Bytes())
+	}
+	if q.Dropped() == 0 || q.Dropped()+q.Len() != 100 {
+		t.Errorf("Dropped = %d, Len = %d; want the oldest records dropped and the rest pending", q.Dropped(), q.Len())
+	}
+	pending := q.Len()
+	q.Close()
+
+	// A new process picks up what was left, newest records last
+	q, err = OpenDiskQueue(dir, 1024, 256)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != pending {
+		t.Fatalf("reopened Len = %d, want %d", q.Len(), pending)
+	}
+	var last string
+	n, err := q.Drain(func(records []queueRecord) error {
+		last = string(records[len(records)-1].Data)
+		return nil
+	})
+	if err != nil || n != pending || last != `{"n":99}` {
+		t.Errorf("Drain = %d, %v, last %s; want %d records ending with n 99", n, err, last, pending)
+	}
+}
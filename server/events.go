@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	eventsStreamKey     = "events" // Redis stream of processed requests
+	eventsFlushInterval = time.Second
+	eventsBufferSize    = 10000
+	eventsReadBatch     = 1000
+)
+
+// EventLogConfig controls persisting every processed request to Redis so
+// traffic can be exported and replayed later
+type EventLogConfig struct {
+	Enabled  bool  `json:"enabled"`
+	MaxLen   int64 `json:"max_len"`  // Approximate number of events kept
+	Payloads bool  `json:"payloads"` // Store payloads; without them replays send filler of the same size
+}
+
+// DefaultEventLogConfig returns the event log settings used out of the box
+func DefaultEventLogConfig() EventLogConfig {
+	return EventLogConfig{
+		Enabled:  false,
+		MaxLen:   1000000,
+		Payloads: true,
+	}
+}
+
+// Event is one processed request. It is the line format of exported JSONL.
+type Event struct {
+	IP          string `json:"ip"`
+	Timestamp   int64  `json:"timestamp"`   // Request timestamp in Unix nanoseconds
+	ReceivedAt  int64  `json:"received_at"` // Unix milliseconds
+	PayloadSize int    `json:"payload_size"`
+	Payload     []byte `json:"payload,omitempty"`
+	Status      string `json:"status"`           // Decision before monitor mode is applied
+	Reason      string `json:"reason,omitempty"` // Reason label of the check that matched, e.g. "rate_limit"
+	Rule        string `json:"rule,omitempty"`
+}
+
+func (e Event) values() map[string]interface{} {
+	v := map[string]interface{}{
+		"ip":     e.IP,
+		"ts":     e.Timestamp,
+		"at":     e.ReceivedAt,
+		"size":   e.PayloadSize,
+		"status": e.Status,
+	}
+	if e.Reason != "" {
+		v["reason"] = e.Reason
+	}
+	if e.Rule != "" {
+		v["rule"] = e.Rule
+	}
+	if e.Payload != nil {
+		v["payload"] = e.Payload
+	}
+	return v
+}
+
+func eventFromMessage(msg redis.XMessage) (Event, error) {
+	field := func(name string) string {
+		s, _ := msg.Values[name].(string)
+		return s
+	}
+
+	e := Event{IP: field("ip"), Status: field("status"), Reason: field("reason"), Rule: field("rule")}
+	var err error
+	if e.Timestamp, err = strconv.ParseInt(field("ts"), 10, 64); err != nil {
+		return e, fmt.Errorf("event %s: bad ts: %w", msg.ID, err)
+	}
+	if e.ReceivedAt, err = strconv.ParseInt(field("at"), 10, 64); err != nil {
+		return e, fmt.Errorf("event %s: bad at: %w", msg.ID, err)
+	}
+	if e.PayloadSize, err = strconv.Atoi(field("size")); err != nil {
+		return e, fmt.Errorf("event %s: bad size: %w", msg.ID, err)
+	}
+	if p, ok := msg.Values["payload"].(string); ok {
+		e.Payload = []byte(p)
+	}
+	return e, nil
+}
+
+// EventRecorder buffers events and writes them to the Redis stream in
+// batches. Events are dropped rather than slowing down requests.
+type EventRecorder struct {
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// NewEventRecorder returns an empty recorder
+func NewEventRecorder() *EventRecorder {
+	return &EventRecorder{events: make(chan Event, eventsBufferSize)}
+}
+
+// Record queues e for the next flush
+func (r *EventRecorder) Record(e Event) {
+	select {
+	case r.events <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// startEventRecorder flushes queued events to Redis every second
+func (s *Server) startEventRecorder(ctx context.Context) {
+	ticker := time.NewTicker(eventsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n := s.events.dropped.Swap(0); n > 0 {
+			log.Printf("Event log: dropped %d events (buffer full)", n)
+		}
+		if err := s.flushEvents(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Event log flush error: %v", err)
+		}
+	}
+}
+
+// flushEvents writes queued events to Redis. Events Redis doesn't take are
+// spooled to the disk queue.
+func (s *Server) flushEvents(ctx context.Context) error {
+	maxLen := s.config().Events.MaxLen
+	pipe := s.rdb.Pipeline()
+	var events []Event
+drain:
+	for len(events) < eventsBufferSize {
+		select {
+		case e := <-s.events.events:
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: eventsStreamKey,
+				MaxLen: maxLen,
+				Approx: true,
+				Values: e.values(),
+			})
+			events = append(events, e)
+		default:
+			break drain
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	cmds, err := pipe.Exec(ctx)
+	if err == nil {
+		return nil
+	}
+
+	var failed []json.RawMessage
+	for i, e := range events {
+		if i < len(cmds) && cmds[i].Err() == nil {
+			continue
+		}
+		if data, err := json.Marshal(e); err == nil {
+			failed = append(failed, data)
+		}
+	}
+	s.spool(queueKindEvent, failed)
+	return err
+}
+
+// ReadEvents calls fn for every stored event received between since and
+// until, oldest first. Zero times leave that end open.
+func ReadEvents(ctx context.Context, rdb redis.Cmdable, since, until time.Time, fn func(Event) error) error {
+	start, end := "-", "+"
+	if !since.IsZero() {
+		start = strconv.FormatInt(since.UnixMilli(), 10)
+	}
+	if !until.IsZero() {
+		end = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+
+	for {
+		msgs, err := rdb.XRangeN(ctx, eventsStreamKey, start, end, eventsReadBatch).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			e, err := eventFromMessage(msg)
+			if err != nil {
+				return err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < eventsReadBatch {
+			return nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// ParseTime reads an RFC 3339 time, or a duration meaning that long before
+// now. An empty string is the zero time.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// eventsExportHandler serves GET /api/events/export?since=1h[&until=...] as JSONL
+func (s *Server) eventsExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	since, err := ParseTime(r.URL.Query().Get("since"), now)
+	if err != nil {
+		http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	until, err := ParseTime(r.URL.Query().Get("until"), now)
+	if err != nil {
+		http.Error(w, "until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	err = ReadEvents(r.Context(), s.rdb, since, until, func(e Event) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		// Headers are gone; the truncated body is all the client gets
+		log.Printf("Event export error: %v", err)
+	}
+	out.Flush()
+}
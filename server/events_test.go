@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"1h", now.Add(-time.Hour), false},
+		{"90s", now.Add(-90 * time.Second), false},
+		{"2024-04-30T08:00:00Z", time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+		{"2024-04-30", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadEventsRange(t *testing.T) {
+	s, _ := newTestServer(t, DefaultConfig())
+	ctx := context.Background()
+
+	// More than one read batch, one event per millisecond
+	const n = eventsReadBatch + 500
+	start := time.UnixMilli(1700000000000)
+	for i := 0; i < n; i++ {
+		e := Event{IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Timestamp: int64(i), ReceivedAt: start.UnixMilli() + int64(i), PayloadSize: i, Status: "ALLOWED"}
+		id := fmt.Sprintf("%d-0", e.ReceivedAt)
+		if err := s.rdb.XAdd(ctx, &redis.XAddArgs{Stream: eventsStreamKey, ID: id, Values: e.values()}).Err(); err != nil {
+			t.Fatalf("XAdd: %v", err)
+		}
+	}
+
+	var all []Event
+	if err := ReadEvents(ctx, s.rdb, time.Time{}, time.Time{}, func(e Event) error {
+		all = append(all, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+	if len(all) != n {
+		t.Fatalf("read %d events, want %d", len(all), n)
+	}
+	for i, e := range all {
+		if e.PayloadSize != i {
+			t.Fatalf("event %d has size %d, want the stream order", i, e.PayloadSize)
+		}
+	}
+
+	// Both ends are inclusive
+	var sizes []int
+	since, until := start.Add(990*time.Millisecond), start.Add(1010*time.Millisecond)
+	if err := ReadEvents(ctx, s.rdb, since, until, func(e Event) error {
+		sizes = append(sizes, e.PayloadSize)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+	if len(sizes) != 21 || sizes[0] != 990 || sizes[20] != 1010 {
+		t.Errorf("events between since and until = %v, want sizes 990 to 1010", sizes)
+	}
+}
+
+func TestEventLogExport(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimit = 2
+	cfg.Events.Enabled = true
+	cfg.AdminToken = "test-token"
+	s, stream := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		send(t, stream, "10.0.0.1", cfg.SecretKey)
+	}
+
+	// Events are recorded after the response goes out
+	var stored []Event
+	for deadline := time.Now().Add(2 * time.Second); len(stored) < 3 && time.Now().Before(deadline); {
+		if err := s.flushEvents(ctx); err != nil {
+			t.Fatalf("flushEvents: %v", err)
+		}
+		stored = stored[:0]
+		if err := ReadEvents(ctx, s.rdb, time.Time{}, time.Time{}, func(e Event) error {
+			stored = append(stored, e)
+			return nil
+		}); err != nil {
+			t.Fatalf("ReadEvents: %v", err)
+		}
+	}
+	if len(stored) != 3 {
+		t.Fatalf("stored %d events, want 3", len(stored))
+	}
+	last := stored[2]
+	if last.IP != "10.0.0.1" || last.Status != "BLOCKED_RATE_LIMIT" || last.Reason != "rate_limit" || string(last.Payload) != "payload" || last.Timestamp == 0 {
+		t.Errorf("rate limited event = %+v", last)
+	}
+
+	export := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/events/export?"+query, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rec := httptest.NewRecorder()
+		s.AdminHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The export decodes back to the stored events
+	rec := export("since=1h")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", rec.Code, rec.Body)
+	}
+	var exported []Event
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("decode export: %v", err)
+		}
+		exported = append(exported, e)
+	}
+	if !reflect.DeepEqual(exported, stored) {
+		t.Errorf("exported %+v, want %+v", exported, stored)
+	}
+
+	for _, query := range []string{"since=later", "until=later"} {
+		if rec := export(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("export?%s status = %d, want 400", query, rec.Code)
+		}
+	}
+}
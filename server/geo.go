@@ -0,0 +1,440 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	geoCountryKeyPrefix = "geo:country:" // Hash of requests and blocks per country, one per minute
+	geoASNKeyPrefix     = "geo:asn:"     // Same per ASN
+	geoKeyTTL           = 24 * time.Hour // Longest window the API can report
+	geoBlockedSuffix    = ":blocked"     // Hash field suffix for blocked counts
+	geoUnknown          = "unknown"      // Country of IPs missing from the database
+)
+
+// GeoConfig enables traffic and block counts by country and ASN
+type GeoConfig struct {
+	Database string   `json:"database"` // ip2asn-combined.tsv(.gz) from iptoasn.com; empty disables
+	Rollup   Duration `json:"rollup"`   // How often counts are written to Redis and sent to the dashboard
+	Window   Duration `json:"window"`   // Span covered by the dashboard view
+	Top      int      `json:"top"`      // Countries and ASNs sent to the dashboard
+}
+
+// DefaultGeoConfig returns the aggregate settings used out of the box
+func DefaultGeoConfig() GeoConfig {
+	return GeoConfig{
+		Rollup: Duration(10 * time.Second),
+		Window: Duration(15 * time.Minute),
+		Top:    20,
+	}
+}
+
+func (c GeoConfig) validate() error {
+	if c.Rollup <= 0 || time.Duration(c.Window) < time.Minute || time.Duration(c.Window) > geoKeyTTL || c.Top <= 0 {
+		return fmt.Errorf("geo rollup and top must be positive and window between 1m and %v", geoKeyTTL)
+	}
+	return nil
+}
+
+// GeoInfo is where an IP is registered
+type GeoInfo struct {
+	Country string // ISO 3166 code
+	ASN     uint32
+}
+
+type geoRange struct {
+	start, end netip.Addr
+	info       GeoInfo
+}
+
+// GeoDB maps IP ranges to their country and ASN
+type GeoDB struct {
+	ranges []geoRange // Sorted by start, not overlapping
+	orgs   map[uint32]string
+}
+
+// OpenGeoDB reads an IP-to-ASN database from path, gunzipping it when the
+// name ends in .gz
+func OpenGeoDB(path string) (*GeoDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	db, err := ReadGeoDB(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// ReadGeoDB parses the tab-separated iptoasn.com format: range start, range
+// end, AS number, country code and AS description. Unrouted ranges (AS 0)
+// are skipped.
+func ReadGeoDB(r io.Reader) (*GeoDB, error) {
+	db := &GeoDB{orgs: make(map[uint32]string)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: want at least 4 tab-separated fields", line)
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: AS number: %w", line, err)
+		}
+		if asn == 0 {
+			continue
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.BitLen() != end.BitLen() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+
+		country := fields[3]
+		if country == "" || country == "None" {
+			country = geoUnknown
+		}
+		db.ranges = append(db.ranges, geoRange{start: start, end: end, info: GeoInfo{Country: country, ASN: uint32(asn)}})
+		if len(fields) > 4 {
+			db.orgs[uint32(asn)] = fields[4]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+// Len returns the number of ranges loaded
+func (db *GeoDB) Len() int {
+	return len(db.ranges)
+}
+
+// Lookup returns the country and ASN of ip
+func (db *GeoDB) Lookup(ip string) (GeoInfo, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return GeoInfo{}, false
+	}
+	addr = addr.Unmap()
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].start) }) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) || db.ranges[i].start.BitLen() != addr.BitLen() {
+		return GeoInfo{}, false
+	}
+	return db.ranges[i].info, true
+}
+
+// Org returns the name registered for asn
+func (db *GeoDB) Org(asn uint32) string {
+	return db.orgs[asn]
+}
+
+type geoCounts struct {
+	requests int64
+	blocked  int64
+}
+
+func (c *geoCounts) add(blocked bool) {
+	c.requests++
+	if blocked {
+		c.blocked++
+	}
+}
+
+type geoMinute struct {
+	countries map[string]*geoCounts
+	asns      map[uint32]*geoCounts
+}
+
+// GeoAggregator counts requests by country and ASN and rolls the counts up
+// into per-minute Redis hashes shared by every server
+type GeoAggregator struct {
+	rdb redis.Cmdable
+	db  *GeoDB
+
+	mu      sync.Mutex
+	pending map[int64]*geoMinute // Keyed by minute, not yet flushed
+}
+
+// NewGeoAggregator returns an aggregator looking IPs up in db and writing to rdb
+func NewGeoAggregator(rdb redis.Cmdable, db *GeoDB) *GeoAggregator {
+	return &GeoAggregator{rdb: rdb, db: db, pending: make(map[int64]*geoMinute)}
+}
+
+// Record counts one request from ip
+func (g *GeoAggregator) Record(ip string, blocked bool, now time.Time) {
+	info, ok := g.db.Lookup(ip)
+	if !ok {
+		info.Country = geoUnknown
+	}
+	minute := minuteOf(now)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, ok := g.pending[minute]
+	if !ok {
+		m = &geoMinute{countries: make(map[string]*geoCounts), asns: make(map[uint32]*geoCounts)}
+		g.pending[minute] = m
+	}
+	c, ok := m.countries[info.Country]
+	if !ok {
+		c = &geoCounts{}
+		m.countries[info.Country] = c
+	}
+	c.add(blocked)
+	a, ok := m.asns[info.ASN]
+	if !ok {
+		a = &geoCounts{}
+		m.asns[info.ASN] = a
+	}
+	a.add(blocked)
+}
+
+// flush adds the pending counts to Redis
+func (g *GeoAggregator) flush(ctx context.Context) error {
+	g.mu.Lock()
+	pending := g.pending
+	g.pending = make(map[int64]*geoMinute, 1)
+	g.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	pipe := g.rdb.Pipeline()
+	for minute, m := range pending {
+		countryKey := fmt.Sprintf("%s%d", geoCountryKeyPrefix, minute)
+		for country, c := range m.countries {
+			pipe.HIncrBy(ctx, countryKey, country, c.requests)
+			if c.blocked > 0 {
+				pipe.HIncrBy(ctx, countryKey, country+geoBlockedSuffix, c.blocked)
+			}
+		}
+		pipe.Expire(ctx, countryKey, geoKeyTTL)
+
+		asnKey := fmt.Sprintf("%s%d", geoASNKeyPrefix, minute)
+		for asn, c := range m.asns {
+			field := strconv.FormatUint(uint64(asn), 10)
+			pipe.HIncrBy(ctx, asnKey, field, c.requests)
+			if c.blocked > 0 {
+				pipe.HIncrBy(ctx, asnKey, field+geoBlockedSuffix, c.blocked)
+			}
+		}
+		pipe.Expire(ctx, asnKey, geoKeyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GeoCount is the traffic from one country or ASN. ASN 0 collects IPs
+// missing from the database.
+type GeoCount struct {
+	Country  string `json:"country,omitempty"`
+	ASN      uint32 `json:"asn,omitempty"`
+	Org      string `json:"org,omitempty"`
+	Requests int64  `json:"requests"`
+	Blocked  int64  `json:"blocked"`
+}
+
+// GeoSnapshot is returned by GET /api/geo and broadcast to the dashboard
+type GeoSnapshot struct {
+	Type      string     `json:"type"` // Always "geo"
+	Window    Duration   `json:"window"`
+	Timestamp int64      `json:"timestamp"`
+	Countries []GeoCount `json:"countries"`
+	ASNs      []GeoCount `json:"asns"`
+}
+
+// Snapshot sums every server's counts over the last window and returns the
+// top countries and ASNs by requests
+func (g *GeoAggregator) Snapshot(ctx context.Context, window time.Duration, top int) (GeoSnapshot, error) {
+	now := time.Now()
+	pipe := g.rdb.Pipeline()
+	var countryCmds, asnCmds []*redis.MapStringStringCmd
+	for minute := minuteOf(now.Add(-window)) + 60; minute <= minuteOf(now); minute += 60 {
+		countryCmds = append(countryCmds, pipe.HGetAll(ctx, fmt.Sprintf("%s%d", geoCountryKeyPrefix, minute)))
+		asnCmds = append(asnCmds, pipe.HGetAll(ctx, fmt.Sprintf("%s%d", geoASNKeyPrefix, minute)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return GeoSnapshot{}, err
+	}
+
+	countries := sumGeoFields(countryCmds)
+	asns := sumGeoFields(asnCmds)
+	snapshot := GeoSnapshot{Type: "geo", Window: Duration(window), Timestamp: now.Unix()}
+	for country, c := range countries {
+		snapshot.Countries = append(snapshot.Countries, GeoCount{Country: country, Requests: c.requests, Blocked: c.blocked})
+	}
+	for field, c := range asns {
+		asn, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			continue
+		}
+		org := g.db.Org(uint32(asn))
+		if asn == 0 {
+			org = geoUnknown
+		}
+		snapshot.ASNs = append(snapshot.ASNs, GeoCount{ASN: uint32(asn), Org: org, Requests: c.requests, Blocked: c.blocked})
+	}
+	snapshot.Countries = topGeoCounts(snapshot.Countries, top)
+	snapshot.ASNs = topGeoCounts(snapshot.ASNs, top)
+	return snapshot, nil
+}
+
+// sumGeoFields adds up per-minute hashes of "<key>" and "<key>:blocked" fields
+func sumGeoFields(cmds []*redis.MapStringStringCmd) map[string]*geoCounts {
+	sums := make(map[string]*geoCounts)
+	for _, cmd := range cmds {
+		for field, v := range cmd.Val() {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			key, blocked := strings.CutSuffix(field, geoBlockedSuffix)
+			c, ok := sums[key]
+			if !ok {
+				c = &geoCounts{}
+				sums[key] = c
+			}
+			if blocked {
+				c.blocked += n
+			} else {
+				c.requests += n
+			}
+		}
+	}
+	return sums
+}
+
+// topGeoCounts sorts counts by requests and keeps the first n
+func topGeoCounts(counts []GeoCount, n int) []GeoCount {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Requests != counts[j].Requests {
+			return counts[i].Requests > counts[j].Requests
+		}
+		if counts[i].Country != counts[j].Country {
+			return counts[i].Country < counts[j].Country
+		}
+		return counts[i].ASN < counts[j].ASN
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// startGeoRollup writes the counts to Redis every rollup interval and sends
+// the dashboard the aggregate over the configured window. The aggregate is
+// read back from Redis, so every server's dashboard sees the whole cluster.
+func (s *Server) startGeoRollup(ctx context.Context) {
+	for {
+		cfg := s.config().Geo
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(cfg.Rollup)):
+		}
+
+		if err := s.geo.flush(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Geo rollup error: %v", err)
+			}
+			continue
+		}
+		if s.hub.Count() == 0 {
+			continue
+		}
+		snapshot, err := s.geo.Snapshot(ctx, time.Duration(cfg.Window), cfg.Top)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Geo rollup error: %v", err)
+			}
+			continue
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			continue
+		}
+		s.hub.BroadcastRaw(data)
+	}
+}
+
+// geoHandler serves GET /api/geo?window=1h&limit=N
+func (s *Server) geoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.geo == nil {
+		http.Error(w, "no GeoIP database configured (geo.database)", http.StatusNotFound)
+		return
+	}
+
+	cfg := s.config().Geo
+	window, limit := time.Duration(cfg.Window), cfg.Top
+	q := r.URL.Query()
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute || d > geoKeyTTL {
+			http.Error(w, fmt.Sprintf("window must be a duration between 1m and %v", geoKeyTTL), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	snapshot, err := s.geo.Snapshot(r.Context(), window, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
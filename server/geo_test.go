@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+const testGeoDB = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.4.0\t1.0.7.255\t38803\tAU\tGTELECOM-AUSTRALIA\n" +
+	"1.0.8.0\t1.0.15.255\t0\tNone\tNot routed\n" +
+	"2001:db8::\t2001:db8:ffff:ffff:ffff:ffff:ffff:ffff\t64500\tDE\tDOCUMENTATION\n"
+
+func TestGeoDBLookup(t *testing.T) {
+	db, err := ReadGeoDB(strings.NewReader(testGeoDB))
+	if err != nil {
+		t.Fatalf("ReadGeoDB: %v", err)
+	}
+	if db.Len() != 3 {
+		t.Errorf("Len = %d, want 3 routed ranges", db.Len())
+	}
+
+	tests := []struct {
+		ip     string
+		want   GeoInfo
+		wantOK bool
+	}{
+		{"1.0.0.1", GeoInfo{Country: "US", ASN: 13335}, true},
+		{"1.0.0.255", GeoInfo{Country: "US", ASN: 13335}, true},
+		{"::ffff:1.0.5.9", GeoInfo{Country: "AU", ASN: 38803}, true},
+		{"1.0.1.0", GeoInfo{}, false}, // Between ranges
+		{"1.0.9.1", GeoInfo{}, false}, // Not routed
+		{"0.0.0.1", GeoInfo{}, false}, // Before the first range
+		{"2001:db8::7", GeoInfo{Country: "DE", ASN: 64500}, true},
+		{"2001:db9::", GeoInfo{}, false},
+		{"not-an-ip", GeoInfo{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(tt.ip)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v, %v", tt.ip, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if org := db.Org(13335); org != "CLOUDFLARENET" {
+		t.Errorf("Org(13335) = %q, want CLOUDFLARENET", org)
+	}
+
+	if _, err := ReadGeoDB(strings.NewReader("1.0.0.9\t1.0.0.1\t1\tUS\tX\n")); err == nil {
+		t.Error("ReadGeoDB accepted a range that ends before it starts")
+	}
+}
+
+func TestTopGeoCounts(t *testing.T) {
+	counts := []GeoCount{
+		{Country: "US", Requests: 5},
+		{Country: "CN", Requests: 9, Blocked: 7},
+		{Country: "AU", Requests: 5},
+	}
+	got := topGeoCounts(counts, 2)
+	if len(got) != 2 || got[0].Country != "CN" || got[1].Country != "AU" {
+		t.Errorf("topGeoCounts = %+v, want CN then AU", got)
+	}
+}
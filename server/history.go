@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	historyTTL         = 5 * time.Minute // IPs idle this long are forgotten
+	maxHistoryIPs      = 100_000         // New IPs are not tracked once this many are held
+	historySweepPeriod = time.Minute
+)
+
+// HistoryEntry is one request as seen by the server
+type HistoryEntry struct {
+	Status      string `json:"status"`
+	PayloadSize int    `json:"payload_size"`
+	ReceivedAt  int64  `json:"received_at"` // Unix milliseconds
+	IntervalMs  int64  `json:"interval_ms"` // Since the previous request from the same IP, 0 for the first
+}
+
+type historyRing struct {
+	entries  []HistoryEntry
+	next     int
+	lastSeen time.Time
+}
+
+// RequestHistory keeps the last few requests per source IP so alerts can
+// carry context without a separate lookup
+type RequestHistory struct {
+	mu   sync.Mutex
+	size int
+	ips  map[string]*historyRing
+}
+
+// NewRequestHistory keeps up to size requests per IP. A size of 0 disables it.
+func NewRequestHistory(size int) *RequestHistory {
+	return &RequestHistory{
+		size: size,
+		ips:  make(map[string]*historyRing),
+	}
+}
+
+// Record appends a request for ip
+func (h *RequestHistory) Record(ip, status string, payloadSize int, now time.Time) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.ips[ip]
+	if !ok {
+		if len(h.ips) >= maxHistoryIPs {
+			return
+		}
+		ring = &historyRing{entries: make([]HistoryEntry, 0, h.size)}
+		h.ips[ip] = ring
+	}
+
+	entry := HistoryEntry{
+		Status:      status,
+		PayloadSize: payloadSize,
+		ReceivedAt:  now.UnixMilli(),
+	}
+	if !ring.lastSeen.IsZero() {
+		entry.IntervalMs = now.Sub(ring.lastSeen).Milliseconds()
+	}
+	ring.lastSeen = now
+
+	if len(ring.entries) < h.size {
+		ring.entries = append(ring.entries, entry)
+		return
+	}
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % h.size
+}
+
+// Recent returns the recorded requests for ip, oldest first
+func (h *RequestHistory) Recent(ip string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.ips[ip]
+	if !ok {
+		return nil
+	}
+	return ring.ordered()
+}
+
+// Resize changes how many requests are kept per IP, keeping the newest ones
+// already recorded. A size of 0 disables it and forgets everything.
+func (h *RequestHistory) Resize(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if size == h.size {
+		return
+	}
+	h.size = size
+	if size <= 0 {
+		clear(h.ips)
+		return
+	}
+	for _, ring := range h.ips {
+		entries := ring.ordered()
+		entries = entries[max(0, len(entries)-size):]
+		ring.entries = append(make([]HistoryEntry, 0, size), entries...)
+		ring.next = 0
+	}
+}
+
+// ordered returns the ring's entries oldest first
+func (r *historyRing) ordered() []HistoryEntry {
+	out := make([]HistoryEntry, 0, len(r.entries))
+	out = append(out, r.entries[r.next:]...)
+	out = append(out, r.entries[:r.next]...)
+	return out
+}
+
+// Run forgets idle IPs until ctx is cancelled
+func (h *RequestHistory) Run(ctx context.Context) {
+	ticker := time.NewTicker(historySweepPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.sweep(now)
+		}
+	}
+}
+
+// sweep forgets IPs idle for longer than historyTTL
+func (h *RequestHistory) sweep(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ip, ring := range h.ips {
+		if now.Sub(ring.lastSeen) > historyTTL {
+			delete(h.ips, ip)
+		}
+	}
+}
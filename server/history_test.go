@@ -0,0 +1,102 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestHistory(t *testing.T) {
+	h := NewRequestHistory(3)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		h.Record("10.0.0.1", "allowed", i, now.Add(time.Duration(i)*time.Second))
+	}
+	h.Record("10.0.0.2", "blocked", 7, now)
+
+	got := h.Recent("10.0.0.1")
+	if len(got) != 3 {
+		t.Fatalf("kept %d entries, want 3", len(got))
+	}
+	for i, e := range got {
+		if e.PayloadSize != i+2 {
+			t.Errorf("entry %d payload = %d, want %d (oldest first)", i, e.PayloadSize, i+2)
+		}
+		if e.IntervalMs != 1000 {
+			t.Errorf("entry %d interval = %dms, want 1000ms", i, e.IntervalMs)
+		}
+	}
+	if other := h.Recent("10.0.0.2"); len(other) != 1 || other[0].Status != "blocked" || other[0].IntervalMs != 0 {
+		t.Errorf("10.0.0.2 history = %+v, want one blocked entry with no interval", other)
+	}
+	if h.Recent("10.0.0.3") != nil {
+		t.Errorf("unknown IP has history")
+	}
+
+	// Only IPs idle for longer than the TTL are forgotten
+	h.sweep(now.Add(historyTTL + 2*time.Second))
+	if h.Recent("10.0.0.2") != nil {
+		t.Errorf("idle IP kept after the TTL")
+	}
+	if len(h.Recent("10.0.0.1")) != 3 {
+		t.Errorf("recently seen IP forgotten")
+	}
+
+	disabled := NewRequestHistory(0)
+	disabled.Record("10.0.0.1", "allowed", 1, now)
+	if disabled.Recent("10.0.0.1") != nil {
+		t.Errorf("history_size 0 still records")
+	}
+}
+
+func TestRequestHistoryResize(t *testing.T) {
+	h := NewRequestHistory(4)
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		h.Record("10.0.0.1", "allowed", i, now)
+	}
+
+	h.Resize(2)
+	got := h.Recent("10.0.0.1")
+	if len(got) != 2 || got[0].PayloadSize != 4 || got[1].PayloadSize != 5 {
+		t.Fatalf("after shrinking = %+v, want the newest two", got)
+	}
+	h.Record("10.0.0.1", "allowed", 6, now)
+	if got := h.Recent("10.0.0.1"); len(got) != 2 || got[0].PayloadSize != 5 || got[1].PayloadSize != 6 {
+		t.Errorf("after shrinking and recording = %+v", got)
+	}
+
+	h.Resize(0)
+	h.Record("10.0.0.1", "allowed", 7, now)
+	if h.Recent("10.0.0.1") != nil {
+		t.Errorf("history kept after resizing to 0")
+	}
+}
+
+func TestReloadAppliesHistorySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	if err := os.WriteFile(path, []byte(`{"history_size": 5}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	s, _ := newTestServer(t, cfg)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		s.history.Record("10.0.0.1", "allowed", i, now)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"history_size": 2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := s.history.Recent("10.0.0.1"); len(got) != 2 {
+		t.Errorf("history after reload holds %d entries, want 2", len(got))
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsSendBuffer   = 64               // Messages queued per client; a client this far behind is dropped
+	wsWriteTimeout = 10 * time.Second // Longest a single write may take
+)
+
+// wsClient is one dashboard connection. Only its writer goroutine writes to
+// conn, since a websocket.Conn doesn't allow concurrent writers.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{} // Closed when the client is removed
+}
+
+// WebSocketHub manages all WebSocket connections
+type WebSocketHub struct {
+	mu      sync.RWMutex
+	clients map[*websocket.Conn]*wsClient
+	chaos   *Chaos // Injects client stalls; nil for none
+}
+
+// NewWebSocketHub returns an empty hub
+func NewWebSocketHub() *WebSocketHub {
+	return &WebSocketHub{
+		clients: make(map[*websocket.Conn]*wsClient),
+	}
+}
+
+func (h *WebSocketHub) Add(conn *websocket.Conn) {
+	c := &wsClient{conn: conn, send: make(chan []byte, wsSendBuffer), done: make(chan struct{})}
+	h.mu.Lock()
+	h.clients[conn] = c
+	n := len(h.clients)
+	h.mu.Unlock()
+	log.Printf("WebSocket client connected. Total: %d", n)
+	go h.writer(c)
+}
+
+func (h *WebSocketHub) Remove(conn *websocket.Conn) {
+	h.mu.Lock()
+	c, ok := h.clients[conn]
+	delete(h.clients, conn)
+	n := len(h.clients)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(c.done)
+	conn.Close()
+	log.Printf("WebSocket client disconnected. Total: %d", n)
+}
+
+// Close disconnects every client
+func (h *WebSocketHub) Close() {
+	h.mu.RLock()
+	conns := make([]*websocket.Conn, 0, len(h.clients))
+	for conn := range h.clients {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+	for _, conn := range conns {
+		h.Remove(conn)
+	}
+}
+
+// Count returns the number of connected WebSocket clients
+func (h *WebSocketHub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+func (h *WebSocketHub) Broadcast(payload DashboardPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	h.BroadcastRaw(data)
+}
+
+// BroadcastRaw queues raw JSON data for every client. It is safe to call
+// from several goroutines and doesn't wait for the writes.
+func (h *WebSocketHub) BroadcastRaw(data []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for conn, c := range h.clients {
+		select {
+		case c.send <- data:
+		default:
+			log.Printf("WebSocket client %s is %d messages behind, dropping it", conn.RemoteAddr(), wsSendBuffer)
+			go h.Remove(conn)
+		}
+	}
+}
+
+// writer sends c's queued messages one at a time until c is removed
+func (h *WebSocketHub) writer(c *wsClient) {
+	for {
+		var data []byte
+		select {
+		case <-c.done:
+			return
+		case data = <-c.send:
+		}
+
+		// An injected stall holds each write like a client that stopped
+		// reading. Only this client's queue backs up; broadcasters never wait.
+		if h.chaos != nil {
+			if stall := time.Duration(h.chaos.Active().WebSocketStall); stall > 0 {
+				select {
+				case <-c.done:
+					return
+				case <-time.After(stall):
+				}
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			h.Remove(c.conn)
+			return
+		}
+	}
+}
+
+// wsHandler handles WebSocket upgrade requests
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	s.hub.Add(conn)
+
+	// Keep connection alive, remove on error
+	go func() {
+		defer s.hub.Remove(conn)
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// managementServer implements the ManagementService on top of the same
+// methods the admin REST API uses
+type managementServer struct {
+	pb.UnimplementedManagementServiceServer
+	s *Server
+}
+
+// RegisterManagement attaches the ManagementService to a gRPC server. Every
+// call must carry the admin token; see ManagementAuth.
+func (s *Server) RegisterManagement(r grpc.ServiceRegistrar) {
+	pb.RegisterManagementServiceServer(r, &managementServer{s: s})
+}
+
+// ManagementAuth is a unary interceptor that rejects calls without
+// "authorization: Bearer <admin token>" metadata
+func (s *Server) ManagementAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	token := s.config().AdminToken
+	var got string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			got = strings.TrimPrefix(v[0], "Bearer ")
+		}
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return handler(ctx, req)
+}
+
+func (m *managementServer) GetPolicy(ctx context.Context, req *pb.GetPolicyRequest) (*pb.Policy, error) {
+	return policyToProto(m.s.config().Policy()), nil
+}
+
+func (m *managementServer) SetPolicy(ctx context.Context, req *pb.SetPolicyRequest) (*pb.Policy, error) {
+	p, err := mergePolicy(m.s.config().Policy(), req.GetPolicy(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	p, err = m.s.SetPolicy(p)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return policyToProto(p), nil
+}
+
+func (m *managementServer) EvaluatePolicy(ctx context.Context, req *pb.EvaluateRequest) (*pb.EvaluateResponse, error) {
+	cfg := *m.s.config()
+	if req.GetPolicy() != nil {
+		p, err := mergePolicy(cfg.Policy(), req.GetPolicy(), req.GetPolicyMask().GetPaths())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid policy: %v", err)
+		}
+		cfg = cfg.withPolicy(p)
+	}
+	cfg, err := m.s.dryRunConfig(cfg)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid policy: %v", err)
+	}
+
+	result, err := m.s.Evaluate(ctx, cfg, EvaluationRequest{
+		IP:          req.GetIp(),
+		Key:         req.GetKey(),
+		PayloadSize: int(req.GetPayloadSize()),
+		Payload:     string(req.GetPayload()),
+		Timestamp:   req.GetTimestamp(),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	resp := &pb.EvaluateResponse{
+		Decision:     result.outcome.Decision,
+		Reason:       result.outcome.Reason,
+		Status:       result.Decision,
+		Rule:         result.Rule,
+		Action:       result.Action,
+		RetryAfterMs: result.RetryAfterMs,
+		Message:      result.Message,
+	}
+	for _, c := range result.Checks {
+		resp.Checks = append(resp.Checks, &pb.CheckResult{Check: c.Check, Matched: c.Matched, Rule: c.Rule, Detail: c.Detail})
+	}
+	return resp, nil
+}
+
+func (m *managementServer) ListBlocklist(ctx context.Context, req *pb.ListBlocklistRequest) (*pb.ListBlocklistResponse, error) {
+	resp := &pb.ListBlocklistResponse{}
+	for _, e := range m.s.blocklist.Entries() {
+		resp.Entries = append(resp.Entries, blockEntryToProto(e))
+	}
+	return resp, nil
+}
+
+func (m *managementServer) Block(ctx context.Context, req *pb.BlockRequest) (*pb.BlockEntry, error) {
+	if _, err := NormalizeTarget(req.GetTarget()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetTtlMs() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl_ms must not be negative")
+	}
+	entry, err := m.s.block(ctx, BlockRequest{
+		Target: req.GetTarget(),
+		Reason: req.GetReason(),
+		TTL:    Duration(time.Duration(req.GetTtlMs()) * time.Millisecond),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return blockEntryToProto(entry), nil
+}
+
+func (m *managementServer) Unblock(ctx context.Context, req *pb.UnblockRequest) (*pb.UnblockResponse, error) {
+	if _, err := NormalizeTarget(req.GetTarget()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	n, err := m.s.unblock(ctx, req.GetTarget())
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if n == 0 {
+		return nil, status.Errorf(codes.NotFound, "%s is not blocklisted", req.GetTarget())
+	}
+	return &pb.UnblockResponse{Removed: int32(n)}, nil
+}
+
+func (m *managementServer) GetMode(ctx context.Context, req *pb.GetModeRequest) (*pb.ModeResponse, error) {
+	return &pb.ModeResponse{Mode: m.s.Mode()}, nil
+}
+
+func (m *managementServer) SetMode(ctx context.Context, req *pb.SetModeRequest) (*pb.ModeResponse, error) {
+	if err := m.s.SetMode(req.GetMode()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &pb.ModeResponse{Mode: m.s.Mode()}, nil
+}
+
+func (m *managementServer) GetAttack(ctx context.Context, req *pb.GetAttackRequest) (*pb.AttackStatus, error) {
+	return attackStatusToProto(m.s.attack.Status()), nil
+}
+
+func (m *managementServer) SetAttackOverride(ctx context.Context, req *pb.SetAttackOverrideRequest) (*pb.AttackStatus, error) {
+	st, err := m.s.setAttackOverride(ctx, req.GetOverride())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return attackStatusToProto(st), nil
+}
+
+func (m *managementServer) Reload(ctx context.Context, req *pb.ReloadRequest) (*pb.ModeResponse, error) {
+	if err := m.s.Reload(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.ModeResponse{Mode: m.s.Mode()}, nil
+}
+
+func policyToProto(p Policy) *pb.Policy {
+	out := &pb.Policy{
+		RateLimit:         int64(p.RateLimit),
+		RateLimitWindowMs: time.Duration(p.RateLimitWindow).Milliseconds(),
+		LocalBlockTtlMs:   time.Duration(p.LocalBlockTTL).Milliseconds(),
+		MaxPayloadSize:    int64(p.Inspection.MaxPayloadSize),
+		MaxClockSkewMs:    time.Duration(p.Inspection.MaxClockSkew).Milliseconds(),
+		DenyPatterns:      p.Inspection.DenyPatterns,
+	}
+	for check, a := range p.Actions {
+		out.Actions = append(out.Actions, &pb.ActionRule{Check: check, Action: a.Action, DelayMs: time.Duration(a.Delay).Milliseconds()})
+	}
+	slices.SortFunc(out.Actions, func(a, b *pb.ActionRule) int { return strings.Compare(a.Check, b.Check) })
+	return out
+}
+
+func policyFromProto(p *pb.Policy) Policy {
+	ms := func(v int64) Duration { return Duration(time.Duration(v) * time.Millisecond) }
+	out := Policy{
+		RateLimit:       int(p.GetRateLimit()),
+		RateLimitWindow: ms(p.GetRateLimitWindowMs()),
+		LocalBlockTTL:   ms(p.GetLocalBlockTtlMs()),
+		Inspection: InspectionConfig{
+			MaxPayloadSize: int(p.GetMaxPayloadSize()),
+			MaxClockSkew:   ms(p.GetMaxClockSkewMs()),
+			DenyPatterns:   p.GetDenyPatterns(),
+		},
+	}
+	if len(p.GetActions()) > 0 {
+		out.Actions = make(map[string]ActionConfig, len(p.GetActions()))
+		for _, a := range p.GetActions() {
+			out.Actions[a.GetCheck()] = ActionConfig{Action: a.GetAction(), Delay: ms(a.GetDelayMs())}
+		}
+	}
+	return out
+}
+
+// mergePolicy returns p with the fields of update named in paths. With no
+// paths, the fields update sets to a non-zero value or a non-empty list are
+// taken, so a client leaving a limit out doesn't switch it off.
+func mergePolicy(p Policy, update *pb.Policy, paths []string) (Policy, error) {
+	if len(paths) == 0 {
+		update.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			paths = append(paths, string(fd.Name()))
+			return true
+		})
+	}
+	from := policyFromProto(update)
+	for _, path := range paths {
+		switch path {
+		case "rate_limit":
+			p.RateLimit = from.RateLimit
+		case "rate_limit_window_ms":
+			p.RateLimitWindow = from.RateLimitWindow
+		case "local_block_ttl_ms":
+			p.LocalBlockTTL = from.LocalBlockTTL
+		case "max_payload_size":
+			p.Inspection.MaxPayloadSize = from.Inspection.MaxPayloadSize
+		case "max_clock_skew_ms":
+			p.Inspection.MaxClockSkew = from.Inspection.MaxClockSkew
+		case "deny_patterns":
+			p.Inspection.DenyPatterns = from.Inspection.DenyPatterns
+		case "actions":
+			p.Actions = from.Actions
+		default:
+			return Policy{}, fmt.Errorf("unknown policy field %q in mask", path)
+		}
+	}
+	return p, nil
+}
+
+func blockEntryToProto(e BlockEntry) *pb.BlockEntry {
+	return &pb.BlockEntry{Target: e.Target, Reason: e.Reason, Source: e.Source, CreatedAt: e.CreatedAt, ExpiresAt: e.ExpiresAt}
+}
+
+func attackStatusToProto(a AttackStatus) *pb.AttackStatus {
+	return &pb.AttackStatus{
+		Active:         a.Active,
+		Override:       a.Override,
+		Since:          a.Since,
+		RpsSpike:       a.Signals.RPSSpike,
+		UniqueIpSpike:  a.Signals.UniqueIPSpike,
+		BlockRatioHigh: a.Signals.BlockRatio,
+		Rps:            a.RPS,
+		BaselineRps:    a.BaselineRPS,
+		BlockRatio:     a.BlockRatio,
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+)
+
+// EvaluationRequest describes a synthetic request for a policy dry run
+type EvaluationRequest struct {
+	IP          string `json:"ip"`
+	Key         string `json:"key"`               // Rate-limit bucket; defaults to the IP
+	PayloadSize int    `json:"payload_size"`      // Used when Payload is empty
+	Payload     string `json:"payload,omitempty"` // Needed to evaluate deny patterns
+	Timestamp   int64  `json:"timestamp"`         // Unix nanoseconds; 0 means now
+
+	// Config is an optional partial config applied on top of the running one,
+	// so a change can be checked before it is deployed
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// CheckResult is the outcome of one pipeline stage in a dry run
+type CheckResult struct {
+	Check   string `json:"check"` // "inspection", "blocklist", "rate_limiter_block" or "rate_limit"
+	Matched bool   `json:"matched"`
+	Rule    string `json:"rule,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// EvaluationResult is the response of a policy dry run
+type EvaluationResult struct {
+	Decision     string        `json:"decision"`         // Status StreamLogs would return
+	Reason       string        `json:"reason,omitempty"` // Reason label of the first matching check
+	Rule         string        `json:"rule,omitempty"`
+	Action       string        `json:"action"` // Response action for the first matching check
+	RetryAfterMs int64         `json:"retry_after_ms,omitempty"`
+	Message      string        `json:"message"`
+	Checks       []CheckResult `json:"checks"`
+
+	outcome Outcome // Typed decision and reason for the management API
+}
+
+// Evaluate runs a synthetic request through the decision pipeline against cfg
+// without recording it. The signature is assumed valid: dry runs describe
+// requests, they don't carry signed payloads. For the same reason replay
+// detection, which keys on the signature, is not part of a dry run.
+func (s *Server) Evaluate(ctx context.Context, cfg Config, req EvaluationRequest) (EvaluationResult, error) {
+	now := time.Now()
+	ts := req.Timestamp
+	if ts == 0 {
+		ts = now.UnixNano()
+	}
+	payload := []byte(req.Payload)
+	if len(payload) == 0 {
+		payload = make([]byte, req.PayloadSize)
+	}
+	key := req.Key
+	if key == "" {
+		key = req.IP
+	}
+
+	var result EvaluationResult
+	var first *Finding
+	decide := func(f Finding) {
+		if first == nil {
+			first = &f
+		}
+	}
+
+	inspection := CheckResult{Check: "inspection"}
+	if v := cfg.Inspection.Rules().Inspect(req.IP, payload, ts, now); v != nil {
+		inspection.Matched, inspection.Rule, inspection.Detail = true, v.Rule, v.Detail
+		decide(Finding{Check: CheckInspection, Rule: v.Rule, Message: v.Error()})
+	}
+	result.Checks = append(result.Checks, inspection)
+
+	blocklist := CheckResult{Check: "blocklist"}
+	if entry, ok := s.blocklist.Match(req.IP); ok {
+		blocklist.Matched, blocklist.Rule, blocklist.Detail = true, entry.Target, entry.Reason
+		decide(Finding{Check: CheckBlocklist, Rule: entry.Target, Message: entry.describe(), RetryAfter: entry.remaining(now)})
+	}
+	result.Checks = append(result.Checks, blocklist)
+
+	limiterBlock := CheckResult{Check: "rate_limiter_block"}
+	if s.localBlocklist.IsBlocked(req.IP) {
+		limiterBlock.Matched, limiterBlock.Detail = true, "IP is in the rate limiter's L1 blocklist"
+		decide(Finding{Check: CheckRateLimit, Message: "IP is temporarily blocked", RetryAfter: s.localBlocklist.Remaining(req.IP)})
+	}
+	result.Checks = append(result.Checks, limiterBlock)
+
+	window := time.Duration(cfg.RateLimitWindow)
+	count, err := core.Count(ctx, s.rdb, fmt.Sprintf("ratelimit:%s", key), now, window)
+	if err != nil {
+		return result, fmt.Errorf("read rate limit: %w", err)
+	}
+	limit := CheckResult{
+		Check:  "rate_limit",
+		Detail: fmt.Sprintf("%d of %d requests used in the last %v", count, cfg.RateLimit, window),
+	}
+	if count >= cfg.RateLimit {
+		limit.Matched = true
+		decide(Finding{Check: CheckRateLimit, Message: fmt.Sprintf("Rate limit exceeded: %d requests per %v", cfg.RateLimit, window)})
+	}
+	result.Checks = append(result.Checks, limit)
+
+	outcome := cfg.outcome(first)
+	result.Decision, result.Action, result.Message = outcome.Status, outcome.Action, outcome.Message
+	result.Reason, result.Rule, result.RetryAfterMs = reasonLabel(outcome.Reason), outcome.Rule, outcome.RetryAfter.Milliseconds()
+	result.outcome = outcome
+	return result, nil
+}
+
+// policyEvaluateHandler serves POST /api/policy/evaluate
+func (s *Server) policyEvaluateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EvaluationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	cfg := s.config().clone()
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, &cfg); err != nil {
+			http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	cfg, err := s.dryRunConfig(cfg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.Evaluate(r.Context(), cfg, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// dryRunConfig validates a config to evaluate against and tightens it the way
+// StreamLogs would while under attack
+func (s *Server) dryRunConfig(cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	if s.attack.Active() {
+		cfg = cfg.underAttack()
+	}
+	return cfg, nil
+}
+
+// Policy is the part of the config that decides requests. It can be replaced
+// at runtime without editing the config file.
+type Policy struct {
+	RateLimit       int                     `json:"rate_limit"`
+	RateLimitWindow Duration                `json:"rate_limit_window"`
+	LocalBlockTTL   Duration                `json:"local_block_ttl"`
+	Inspection      InspectionConfig        `json:"inspection"`
+	Actions         map[string]ActionConfig `json:"actions"`
+}
+
+// Policy returns a copy of the policy in c
+func (c Config) Policy() Policy {
+	return Policy{
+		RateLimit:       c.RateLimit,
+		RateLimitWindow: c.RateLimitWindow,
+		LocalBlockTTL:   c.LocalBlockTTL,
+		Inspection: InspectionConfig{
+			MaxPayloadSize: c.Inspection.MaxPayloadSize,
+			MaxClockSkew:   c.Inspection.MaxClockSkew,
+			DenyPatterns:   slices.Clone(c.Inspection.DenyPatterns),
+		},
+		Actions: maps.Clone(c.Actions),
+	}
+}
+
+// withPolicy returns c with its policy replaced by p
+func (c Config) withPolicy(p Policy) Config {
+	c.RateLimit = p.RateLimit
+	c.RateLimitWindow = p.RateLimitWindow
+	c.LocalBlockTTL = p.LocalBlockTTL
+	c.Inspection = p.Inspection
+	c.Actions = p.Actions
+	return c
+}
+
+// SetPolicy replaces the policy in force until the next reload. It is saved
+// to Redis so a restart keeps it. The enforcement mode is left as it is.
+func (s *Server) SetPolicy(p Policy) (Policy, error) {
+	cfg := s.config().withPolicy(p)
+	cfg.Mode = s.Mode()
+	if err := cfg.Validate(); err != nil {
+		return Policy{}, err
+	}
+	s.setConfig(cfg)
+	s.savePolicyState("policy", cfg.Policy())
+	log.Printf("Policy replaced (rate limit %d per %v, %d deny patterns, %d actions)", cfg.RateLimit, cfg.RateLimitWindow, len(cfg.Inspection.DenyPatterns), len(cfg.Actions))
+	return cfg.Policy(), nil
+}
+
+// policyHandler serves GET and PUT /api/policy. Fields left out of a PUT keep
+// their current values; actions, when given, replace the current ones as
+// SetPolicy does over gRPC.
+func (s *Server) policyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.config().Policy())
+	case http.MethodPut:
+		current := s.config().Policy()
+		p := current
+		p.Actions = nil // Decoding would merge into the current map
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&p); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if p.Actions == nil {
+			p.Actions = current.Actions
+		}
+		p, err := s.SetPolicy(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateIsSideEffectFree(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimit = 2
+	s, stream := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	for i := 0; i < cfg.RateLimit; i++ {
+		send(t, stream, "10.0.0.1", cfg.SecretKey)
+	}
+
+	req := EvaluationRequest{IP: "10.0.0.1", PayloadSize: 64}
+	for i := 0; i < 3; i++ {
+		got, err := s.Evaluate(ctx, cfg, req)
+		if err != nil {
+			t.Fatalf("Evaluate: %v", err)
+		}
+		if got.Decision != "BLOCKED_RATE_LIMIT" {
+			t.Fatalf("run %d: decision %s, want BLOCKED_RATE_LIMIT", i, got.Decision)
+		}
+	}
+	if s.localBlocklist.IsBlocked("10.0.0.1") {
+		t.Errorf("dry run added the IP to the blocklist")
+	}
+
+	// A raised limit in a candidate config lets the same request through
+	candidate := cfg
+	if err := json.Unmarshal([]byte(`{"rate_limit": 10}`), &candidate); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Evaluate(ctx, candidate, req)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if got.Decision != "ALLOWED" {
+		t.Errorf("candidate config: decision %s, want ALLOWED", got.Decision)
+	}
+
+	got, err = s.Evaluate(ctx, cfg, EvaluationRequest{IP: "10.0.0.2", PayloadSize: cfg.Inspection.MaxPayloadSize + 1})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if got.Decision != "BLOCKED_MALFORMED" || got.Checks[0].Rule != "payload_too_large" {
+		t.Errorf("oversized payload: got %+v", got)
+	}
+}
+
+func TestPolicyPutReplacesActions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminToken = "test-token"
+	cfg.Actions = map[string]ActionConfig{
+		CheckSignature: {Action: ActionAlert},
+		CheckRateLimit: {Action: ActionThrottle, Delay: Duration(time.Second)},
+	}
+	s, _ := newTestServer(t, cfg)
+	h := s.AdminHandler()
+
+	put := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/policy", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s: status %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+
+	put(`{"actions": {"signature": {"action": "alert"}}}`)
+	if got := s.config().Actions; len(got) != 1 || got[CheckSignature].Action != ActionAlert {
+		t.Errorf("actions after PUT = %v, want only signature", got)
+	}
+
+	// Leaving actions out keeps them
+	put(`{"rate_limit": 50}`)
+	if got := s.config(); got.RateLimit != 50 || len(got.Actions) != 1 {
+		t.Errorf("after PUT of rate_limit: limit %d, actions %v; want 50 and signature kept", got.RateLimit, got.Actions)
+	}
+}
+
+func TestPolicyEvaluateLeavesConfigAlone(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminToken = "test-token"
+	cfg.Inspection.DenyPatterns = []string{"aaa", "bbb"}
+	cfg.Actions = map[string]ActionConfig{CheckRateLimit: {Action: ActionThrottle, Delay: Duration(time.Second)}}
+	s, _ := newTestServer(t, cfg)
+
+	body := `{"ip": "10.0.0.1", "config": {"actions": {"rate_limit": {"action": "allow"}}, "inspection": {"deny_patterns": ["zzz"]}}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/policy/evaluate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-token")
+	rec := httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("evaluate: status %d: %s", rec.Code, rec.Body)
+	}
+
+	got := s.config()
+	if p := got.Inspection.DenyPatterns; len(p) != 2 || p[0] != "aaa" || p[1] != "bbb" {
+		t.Errorf("deny_patterns after evaluate = %v, want [aaa bbb]", p)
+	}
+	if a := got.Actions; len(a) != 1 || a[CheckRateLimit].Action != ActionThrottle {
+		t.Errorf("actions after evaluate = %v, want rate_limit throttle", a)
+	}
+}
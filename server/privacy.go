@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+const retentionPurgeInterval = time.Minute
+
+// Privacy modes
+const (
+	PrivacyOff      = "off"      // Store and show full IPs
+	PrivacyHash     = "hash"     // Replace IPs with a keyed hash
+	PrivacyTruncate = "truncate" // Zero the host bits of IPs
+)
+
+// PrivacyConfig controls how source IPs appear in data that leaves the
+// request path: the event log and its exports, alerts, alert sinks, the
+// dashboard feed and logs. Enforcement always sees the full IP.
+type PrivacyConfig struct {
+	Mode       string   `json:"mode"`
+	HashKey    string   `json:"hash_key"`    // HMAC key for hash mode; keep it equal across servers so hashes match
+	IPv4Prefix int      `json:"ipv4_prefix"` // Bits kept in truncate mode
+	IPv6Prefix int      `json:"ipv6_prefix"` // Bits kept in truncate mode
+	Retention  Duration `json:"retention"`   // Stored events and alerts older than this are purged, 0 keeps them up to max_len
+}
+
+// DefaultPrivacyConfig returns the privacy settings used out of the box
+func DefaultPrivacyConfig() PrivacyConfig {
+	return PrivacyConfig{
+		Mode:       PrivacyOff,
+		IPv4Prefix: 24,
+		IPv6Prefix: 48,
+	}
+}
+
+func (c PrivacyConfig) validate() error {
+	switch c.Mode {
+	case "", PrivacyOff:
+	case PrivacyHash:
+		if c.HashKey == "" {
+			return errors.New("privacy hash mode requires hash_key")
+		}
+	case PrivacyTruncate:
+		if c.IPv4Prefix < 0 || c.IPv4Prefix > 32 || c.IPv6Prefix < 0 || c.IPv6Prefix > 128 {
+			return errors.New("privacy ipv4_prefix must be 0-32 and ipv6_prefix 0-128")
+		}
+	default:
+		return errors.New("privacy mode must be off, hash or truncate")
+	}
+	if c.Retention < 0 {
+		return errors.New("privacy retention must not be negative")
+	}
+	return nil
+}
+
+// enabled reports whether IPs are anonymized
+func (c PrivacyConfig) enabled() bool {
+	return c.Mode != "" && c.Mode != PrivacyOff
+}
+
+// Anonymize returns ip as it may be stored or shown. Hashes look like
+// "anon-3f9a1c2b7d4e5f60"; truncated IPs are still addresses so the events
+// they are stored in can be replayed.
+func (c PrivacyConfig) Anonymize(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	switch c.Mode {
+	case PrivacyHash:
+		mac := hmac.New(sha256.New, []byte(c.HashKey))
+		mac.Write([]byte(ip))
+		return "anon-" + hex.EncodeToString(mac.Sum(nil)[:8])
+	case PrivacyTruncate:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return "invalid"
+		}
+		bits := c.IPv6Prefix
+		if addr.Unmap().Is4() {
+			addr, bits = addr.Unmap(), c.IPv4Prefix
+		}
+		prefix, err := addr.WithZone("").Prefix(bits)
+		if err != nil {
+			return "invalid"
+		}
+		return prefix.Addr().String()
+	default:
+		return ip
+	}
+}
+
+// startRetentionPurge removes stored events and alerts older than privacy.retention
+// every minute. The setting is re-read each time so reloads apply.
+func (s *Server) startRetentionPurge(ctx context.Context) {
+	ticker := time.NewTicker(retentionPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			retention := time.Duration(s.config().Privacy.Retention)
+			if retention <= 0 {
+				continue
+			}
+			minID := strconv.FormatInt(now.Add(-retention).UnixMilli(), 10)
+			for _, key := range []string{eventsStreamKey, alertsStreamKey} {
+				n, err := s.rdb.XTrimMinID(ctx, key, minID).Result()
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Retention purge error: %v", err)
+					}
+					continue
+				}
+				if n > 0 {
+					log.Printf("Retention purge: removed %d %s older than %v", n, key, retention)
+				}
+			}
+		}
+	}
+}
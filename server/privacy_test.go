@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	truncate := PrivacyConfig{Mode: PrivacyTruncate, IPv4Prefix: 24, IPv6Prefix: 48}
+	tests := []struct {
+		ip, want string
+	}{
+		{"203.0.113.77", "203.0.113.0"},
+		{"::ffff:203.0.113.77", "203.0.113.0"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1::"},
+		{"not-an-ip", "invalid"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := truncate.Anonymize(tt.ip); got != tt.want {
+			t.Errorf("truncate %q = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	hash := PrivacyConfig{Mode: PrivacyHash, HashKey: "k1"}
+	a, b := hash.Anonymize("203.0.113.77"), hash.Anonymize("203.0.113.78")
+	if !strings.HasPrefix(a, "anon-") || strings.Contains(a, "203.0.113") {
+		t.Errorf("hash = %q, want an anon- hash without the IP", a)
+	}
+	if a == b || a != hash.Anonymize("203.0.113.77") {
+		t.Errorf("hashes must be stable and differ per IP: %q, %q", a, b)
+	}
+	hash.HashKey = "k2"
+	if hash.Anonymize("203.0.113.77") == a {
+		t.Errorf("hash did not change with hash_key")
+	}
+
+	if got := DefaultPrivacyConfig().Anonymize("203.0.113.77"); got != "203.0.113.77" {
+		t.Errorf("off = %q, want the full IP", got)
+	}
+}
+
+func TestFindingAlertsAnonymized(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Privacy = PrivacyConfig{Mode: PrivacyHash, HashKey: "k"}
+	cfg.Actions = map[string]ActionConfig{
+		CheckBlocklist:  {Action: ActionAlert},
+		CheckInspection: {Action: ActionAlert},
+	}
+	s, stream := newTestServer(t, cfg)
+	ctx := context.Background()
+	if err := s.blocklist.Add(ctx, []BlockEntry{{Target: "10.0.0.7", Reason: "scanner"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	send(t, stream, "10.0.0.7", cfg.SecretKey)
+	send(t, stream, "10.0.0.300", cfg.SecretKey) // Not an IP; inspection quotes it
+	page, err := QueryAlerts(ctx, s.rdb, AlertQuery{Kinds: []string{"finding"}})
+	if err != nil {
+		t.Fatalf("QueryAlerts: %v", err)
+	}
+	if len(page.Alerts) != 2 {
+		t.Fatalf("got %d finding alerts, want 2", len(page.Alerts))
+	}
+	for _, a := range page.Alerts {
+		data, _ := json.Marshal(a)
+		if strings.Contains(string(data), "10.0.0.") {
+			t.Errorf("alert names the source IP: %s", data)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"strings"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// numReasons sizes arrays indexed by pb.Reason: the highest value plus one
+const numReasons = int(pb.Reason_REASON_RATE_LIMIT) + 1
+
+// checkReasons maps each pipeline check to the reason code it reports
+var checkReasons = map[string]pb.Reason{
+	CheckSignature:  pb.Reason_REASON_INVALID_SIGNATURE,
+	CheckInspection: pb.Reason_REASON_MALFORMED,
+	CheckBlocklist:  pb.Reason_REASON_BLOCKLIST,
+	CheckReplay:     pb.Reason_REASON_REPLAY,
+	CheckRateLimit:  pb.Reason_REASON_RATE_LIMIT,
+}
+
+// blockStatuses is the legacy status string a block answers with for each reason
+var blockStatuses = map[pb.Reason]string{
+	pb.Reason_REASON_INVALID_SIGNATURE: "BLOCKED_INVALID_SIG",
+	pb.Reason_REASON_MALFORMED:         "BLOCKED_MALFORMED",
+	pb.Reason_REASON_BLOCKLIST:         "BLOCKED_BLOCKLIST",
+	pb.Reason_REASON_REPLAY:            "BLOCKED_REPLAY",
+	pb.Reason_REASON_RATE_LIMIT:        "BLOCKED_RATE_LIMIT",
+}
+
+// reasonLabel is the name of r in events, metrics and the dashboard, e.g.
+// "rate_limit". REASON_NONE has no label.
+func reasonLabel(r pb.Reason) string {
+	if r == pb.Reason_REASON_NONE {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(r.String(), "REASON_"))
+}
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	regionReadBlock  = 5 * time.Second
+	regionReadBatch  = 500
+	regionRetryDelay = 5 * time.Second
+)
+
+// RegionPeer is another region's Redis, read for its blocklist changes
+type RegionPeer struct {
+	Name          string `json:"name"`
+	RedisAddr     string `json:"redis_addr"`
+	RedisPassword string `json:"redis_password,omitempty"`
+}
+
+// RegionSyncConfig bridges the blocklist between regions that each have
+// their own Redis. Changes are merged last-writer-wins on wall-clock time.
+type RegionSyncConfig struct {
+	Region        string       `json:"region"` // This region's name; empty disables sync
+	Peers         []RegionPeer `json:"peers"`
+	MergeInterval Duration     `json:"merge_interval"` // Full reconciliation with each peer, catching anything the change stream missed
+	TombstoneTTL  Duration     `json:"tombstone_ttl"`  // How long removals are remembered so a stale add can't resurrect them
+}
+
+// DefaultRegionSyncConfig returns the region sync settings used out of the box
+func DefaultRegionSyncConfig() RegionSyncConfig {
+	return RegionSyncConfig{
+		MergeInterval: Duration(5 * time.Minute),
+		TombstoneTTL:  Duration(7 * 24 * time.Hour),
+	}
+}
+
+// Enabled reports whether this server syncs its blocklist with other regions
+func (c RegionSyncConfig) Enabled() bool {
+	return c.Region != "" && len(c.Peers) > 0
+}
+
+func (c RegionSyncConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.MergeInterval <= 0 || c.TombstoneTTL <= 0 {
+		return errors.New("regions merge_interval and tombstone_ttl must be positive")
+	}
+	names := map[string]bool{c.Region: true}
+	for _, p := range c.Peers {
+		if p.Name == "" || p.RedisAddr == "" {
+			return errors.New("regions peers need a name and redis_addr")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("regions: duplicate region name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// BlocklistChange is one add or remove in a region's change stream
+type BlocklistChange struct {
+	Target  string
+	Version int64       // Unix milliseconds of the change
+	Region  string      // Where it was made
+	Entry   *BlockEntry // nil for a removal
+}
+
+func (c BlocklistChange) values() map[string]interface{} {
+	v := map[string]interface{}{
+		"target":  c.Target,
+		"version": c.Version,
+		"region":  c.Region,
+	}
+	if c.Entry != nil {
+		data, _ := json.Marshal(c.Entry)
+		v["entry"] = data
+	}
+	return v
+}
+
+func changeFromMessage(msg redis.XMessage) (BlocklistChange, error) {
+	field := func(name string) string {
+		s, _ := msg.Values[name].(string)
+		return s
+	}
+
+	c := BlocklistChange{Target: field("target"), Region: field("region")}
+	var err error
+	if c.Version, err = strconv.ParseInt(field("version"), 10, 64); err != nil {
+		return c, fmt.Errorf("change %s: bad version: %w", msg.ID, err)
+	}
+	if data := field("entry"); data != "" {
+		c.Entry = &BlockEntry{}
+		if err := json.Unmarshal([]byte(data), c.Entry); err != nil {
+			return c, fmt.Errorf("change %s: bad entry: %w", msg.ID, err)
+		}
+	}
+	return c, nil
+}
+
+// applyChangeScript applies a change only if it is newer than the target's
+// current version, and returns the target's entry afterwards (nil if absent)
+var applyChangeScript = redis.NewScript(`
+	local target = ARGV[1]
+	local version = tonumber(ARGV[2])
+	local entry = ARGV[3]
+
+	local current = tonumber(redis.call('HGET', KEYS[2], target) or '-1')
+	if version > current then
+		redis.call('HSET', KEYS[2], target, version)
+		if entry == '' then
+			redis.call('HDEL', KEYS[1], target)
+		else
+			redis.call('HSET', KEYS[1], target, entry)
+		end
+	end
+	return redis.call('HGET', KEYS[1], target)
+`)
+
+// apply merges a change from another region into Redis and the local copy
+func (b *Blocklist) apply(ctx context.Context, c BlocklistChange) error {
+	target, err := NormalizeTarget(c.Target)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if c.Entry != nil {
+		c.Entry.Target = target
+		if data, err = json.Marshal(c.Entry); err != nil {
+			return err
+		}
+	}
+
+	result, err := applyChangeScript.Run(ctx, b.rdb, []string{blocklistKey, blocklistVersionsKey}, target, c.Version, data).Text()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if result == "" {
+		b.deleteLocked(target)
+		return nil
+	}
+	var e BlockEntry
+	if err := json.Unmarshal([]byte(result), &e); err != nil {
+		return err
+	}
+	b.setLocked(e)
+	return nil
+}
+
+// snapshot reads a region's whole blocklist as changes. Entries from before
+// sync was enabled have no version and count as made when they were created.
+func snapshot(ctx context.Context, rdb redis.Cmdable) ([]BlocklistChange, error) {
+	entries, err := rdb.HGetAll(ctx, blocklistKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := rdb.HGetAll(ctx, blocklistVersionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]BlocklistChange, 0, len(versions))
+	for target, data := range entries {
+		e := &BlockEntry{}
+		if err := json.Unmarshal([]byte(data), e); err != nil {
+			continue
+		}
+		version := e.CreatedAt * 1000
+		if v, err := strconv.ParseInt(versions[target], 10, 64); err == nil {
+			version = v
+		}
+		changes = append(changes, BlocklistChange{Target: target, Version: version, Entry: e})
+	}
+	for target, v := range versions {
+		if _, ok := entries[target]; ok {
+			continue
+		}
+		if version, err := strconv.ParseInt(v, 10, 64); err == nil {
+			changes = append(changes, BlocklistChange{Target: target, Version: version})
+		}
+	}
+	return changes, nil
+}
+
+// purgeTombstones forgets removals older than ttl
+func (b *Blocklist) purgeTombstones(ctx context.Context, ttl time.Duration) error {
+	changes, err := snapshot(ctx, b.rdb)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-ttl).UnixMilli()
+	var old []string
+	for _, c := range changes {
+		if c.Entry == nil && c.Version < cutoff {
+			old = append(old, c.Target)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	return b.rdb.HDel(ctx, blocklistVersionsKey, old...).Err()
+}
+
+// RegionStatus is one peer's sync state, returned by GET /api/regions
+type RegionStatus struct {
+	Name       string `json:"name"`
+	RedisAddr  string `json:"redis_addr"`
+	Connected  bool   `json:"connected"`
+	LastChange int64  `json:"last_change,omitempty"` // Unix ms of the last change applied from this peer
+	LastMerge  int64  `json:"last_merge,omitempty"`  // Unix seconds of the last full reconciliation
+	Applied    int64  `json:"applied"`               // Changes read from this peer since start
+	Error      string `json:"error,omitempty"`
+}
+
+// regionPeer is a connection to one other region
+type regionPeer struct {
+	RegionPeer
+	rdb *redis.Client
+
+	mu     sync.Mutex
+	status RegionStatus
+}
+
+func (p *regionPeer) update(fn func(*RegionStatus)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(&p.status)
+}
+
+// RegionSync keeps this region's blocklist merged with its peers'
+type RegionSync struct {
+	peers []*regionPeer
+}
+
+// NewRegionSync opens clients for the configured peers. Peers that are
+// down are retried by Run.
+func NewRegionSync(cfg RegionSyncConfig) *RegionSync {
+	r := &RegionSync{}
+	for _, p := range cfg.Peers {
+		r.peers = append(r.peers, &regionPeer{
+			RegionPeer: p,
+			rdb:        redis.NewClient(&redis.Options{Addr: p.RedisAddr, Password: p.RedisPassword}),
+			status:     RegionStatus{Name: p.Name, RedisAddr: p.RedisAddr},
+		})
+	}
+	return r
+}
+
+// Status returns the state of every peer
+func (r *RegionSync) Status() []RegionStatus {
+	out := make([]RegionStatus, 0, len(r.peers))
+	for _, p := range r.peers {
+		p.mu.Lock()
+		out = append(out, p.status)
+		p.mu.Unlock()
+	}
+	return out
+}
+
+// Close closes the peer clients
+func (r *RegionSync) Close() {
+	for _, p := range r.peers {
+		p.rdb.Close()
+	}
+}
+
+// startRegionSync follows every peer's change stream until ctx is cancelled
+func (s *Server) startRegionSync(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range s.regions.peers {
+		wg.Add(1)
+		go func(p *regionPeer) {
+			defer wg.Done()
+			s.followRegion(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// followRegion applies one peer's changes as they happen, reconciling fully
+// at start, after errors and every merge_interval
+func (s *Server) followRegion(ctx context.Context, p *regionPeer) {
+	var last string // Change stream position; empty means a full merge is due
+	var nextMerge time.Time
+
+	for ctx.Err() == nil {
+		cfg := s.config().Regions
+		var err error
+		if last == "" || time.Now().After(nextMerge) {
+			last, err = s.mergeRegion(ctx, p, time.Duration(cfg.TombstoneTTL))
+			nextMerge = time.Now().Add(time.Duration(cfg.MergeInterval))
+		}
+		if err == nil {
+			last, err = s.readRegionChanges(ctx, p, last)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Region sync with %s: %v", p.Name, err)
+			p.update(func(st *RegionStatus) { st.Connected, st.Error = false, err.Error() })
+			last = ""
+			select {
+			case <-ctx.Done():
+			case <-time.After(regionRetryDelay):
+			}
+		}
+	}
+}
+
+// mergeRegion applies a peer's whole blocklist and returns the change
+// stream position to follow from
+func (s *Server) mergeRegion(ctx context.Context, p *regionPeer, tombstoneTTL time.Duration) (string, error) {
+	// Note the position first so changes made during the merge are read after it
+	last := "0-0"
+	msgs, err := p.rdb.XRevRangeN(ctx, blocklistChangesKey, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) > 0 {
+		last = msgs[0].ID
+	}
+
+	changes, err := snapshot(ctx, p.rdb)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range changes {
+		if err := s.blocklist.apply(ctx, c); err != nil {
+			return "", fmt.Errorf("apply %s: %w", c.Target, err)
+		}
+	}
+	if err := s.blocklist.purgeTombstones(ctx, tombstoneTTL); err != nil {
+		log.Printf("Region sync: failed to purge tombstones: %v", err)
+	}
+
+	p.update(func(st *RegionStatus) {
+		st.Connected, st.Error = true, ""
+		st.LastMerge = time.Now().Unix()
+	})
+	return last, nil
+}
+
+// readRegionChanges waits briefly for changes after last, applies them and
+// returns the new position
+func (s *Server) readRegionChanges(ctx context.Context, p *regionPeer, last string) (string, error) {
+	streams, err := p.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{blocklistChangesKey, last},
+		Count:   regionReadBatch,
+		Block:   regionReadBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return last, nil
+	}
+	if err != nil {
+		return last, err
+	}
+
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			c, err := changeFromMessage(msg)
+			if err != nil {
+				log.Printf("Region sync with %s: skipping %v", p.Name, err)
+			} else if err := s.blocklist.apply(ctx, c); err != nil {
+				return last, fmt.Errorf("apply %s: %w", c.Target, err)
+			} else {
+				p.update(func(st *RegionStatus) {
+					st.Connected, st.Error = true, ""
+					st.LastChange = c.Version
+					st.Applied++
+				})
+			}
+			last = msg.ID
+		}
+	}
+	return last, nil
+}
+
+// regionsHandler serves GET /api/regions
+func (s *Server) regionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.regions == nil {
+		writeJSON(w, http.StatusOK, []RegionStatus{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.regions.Status())
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// config returns the active configuration. Callers must not modify it.
+func (s *Server) config() *Config {
+	return s.cfg.Load()
+}
+
+// setConfig installs cfg and everything derived from it
+func (s *Server) setConfig(cfg Config) {
+	rules := cfg.Inspection.Rules()
+	attackCfg := cfg.underAttack()
+	attackRules := attackCfg.Inspection.Rules()
+	s.rules.Store(&rules)
+	s.attackRules.Store(&attackRules)
+	s.attackCfg.Store(&attackCfg)
+	s.cfg.Store(&cfg)
+	s.monitor.Store(cfg.Mode == ModeMonitor)
+}
+
+// Reload re-reads the config file the server was started from and applies
+// the settings that can change at runtime: limits, inspection rules, secret
+// key, mode, request history size and blocklist feeds. Listen addresses, the admin token, Redis,
+// the region peers, the GeoIP database, the disk queue and the warm-up
+// instance name keep their current values until restart. A policy or mode
+// set through the API is dropped in favour of the file.
+func (s *Server) Reload() error {
+	current := s.config()
+	if current.Path == "" {
+		return errors.New("server was not started from a config file")
+	}
+
+	cfg, err := LoadConfig(current.Path)
+	if err != nil {
+		return err
+	}
+	cfg.GRPCAddr = current.GRPCAddr
+	cfg.HTTPAddr = current.HTTPAddr
+	cfg.AdminAddr = current.AdminAddr
+	cfg.ManagementAddr = current.ManagementAddr
+	cfg.AdminToken = current.AdminToken
+	cfg.RedisAddr = current.RedisAddr
+	cfg.Regions.Region, cfg.Regions.Peers = current.Regions.Region, current.Regions.Peers
+	cfg.Geo.Database = current.Geo.Database
+	cfg.Queue = current.Queue
+
+	s.setConfig(cfg)
+	s.history.Resize(cfg.HistorySize)
+	s.clearPolicyState() // The file is in charge again
+	if !cfg.AllowFaults {
+		s.chaos.Clear()
+	}
+	s.restartFeeds()
+	log.Printf("Config reloaded from %s (mode %s, rate limit %d per %v)", cfg.Path, s.Mode(), cfg.RateLimit, cfg.RateLimitWindow)
+	return nil
+}
+
+// restartFeeds stops the running blocklist feed importers and starts the
+// configured ones. It does nothing before Start.
+func (s *Server) restartFeeds() {
+	s.feedsMu.Lock()
+	defer s.feedsMu.Unlock()
+
+	if s.ctx == nil {
+		return
+	}
+	if s.stopFeeds != nil {
+		s.stopFeeds()
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopFeeds = cancel
+	for _, feed := range s.config().BlocklistFeeds {
+		go s.startBlocklistFeed(ctx, feed)
+	}
+}
+
+// Mode returns the active enforcement mode
+func (s *Server) Mode() string {
+	if s.monitor.Load() {
+		return ModeMonitor
+	}
+	return ModeEnforce
+}
+
+// SetMode switches between enforce and monitor until the next reload. It is
+// saved to Redis so a restart keeps it.
+func (s *Server) SetMode(mode string) error {
+	switch mode {
+	case ModeEnforce:
+		s.monitor.Store(false)
+	case ModeMonitor:
+		s.monitor.Store(true)
+	default:
+		return fmt.Errorf("mode must be %q or %q", ModeEnforce, ModeMonitor)
+	}
+	s.savePolicyState("mode", mode)
+	log.Printf("Mode switched to %s", mode)
+	return nil
+}
+
+// ModePayload is the body of GET and PUT /api/mode
+type ModePayload struct {
+	Mode string `json:"mode"`
+}
+
+// modeHandler serves GET and PUT /api/mode
+func (s *Server) modeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req ModePayload
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.SetMode(req.Mode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, ModePayload{Mode: s.Mode()})
+}
+
+// reloadHandler serves POST /api/config/reload
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded", "mode": s.Mode()})
+}
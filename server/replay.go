@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+)
+
+const replayKeyPrefix = "replay:" // Set of source IPs per request digest
+
+// ReplayConfig controls detection of the same signed request arriving from
+// several IPs, which points at captured traffic being replayed by a script
+type ReplayConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Window         Duration `json:"window"`           // How long a request is remembered after it was last seen
+	MinIPs         int      `json:"min_ips"`          // Distinct IPs before it counts as a replay
+	MinPayloadSize int      `json:"min_payload_size"` // Smaller payloads are skipped
+	Block          bool     `json:"block"`            // Reject replays with BLOCKED_REPLAY instead of only alerting
+}
+
+// DefaultReplayConfig returns the replay detection settings used out of the box
+func DefaultReplayConfig() ReplayConfig {
+	return ReplayConfig{
+		Enabled:        false,
+		Window:         Duration(10 * time.Minute),
+		MinIPs:         3,
+		MinPayloadSize: 16,
+		Block:          false,
+	}
+}
+
+// checkReplay records ip as a source of the signed request and reports
+// whether it should be blocked as a replay. The alert is raised once per
+// request, by whichever server sees the IP that crosses MinIPs.
+func (s *Server) checkReplay(ctx context.Context, cfg *Config, ip string, payload []byte, signature string) (blocked bool, detail string) {
+	rc := cfg.Replay
+	if !rc.Enabled || len(payload) < rc.MinPayloadSize {
+		return false, ""
+	}
+
+	digest := core.Digest(payload, signature)
+	sources, added, err := core.RecordSource(ctx, s.rdb, replayKeyPrefix+digest, ip, time.Duration(rc.Window))
+	if err != nil {
+		log.Printf("Redis error: %v (skipping replay check)", err)
+		return false, ""
+	}
+	if sources < rc.MinIPs {
+		return false, ""
+	}
+
+	detail = fmt.Sprintf("Identical signed request seen from %d IPs", sources)
+	if added && sources == rc.MinIPs {
+		s.raiseAlert(ctx, Alert{
+			Kind:     "replay_detected",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("Replayed request: identical payload and signature from %d IPs within %v", sources, time.Duration(rc.Window)),
+			IP:       ip,
+			Details: map[string]any{
+				"digest":       digest,
+				"sources":      sources,
+				"payload_size": len(payload),
+				"blocking":     rc.Block,
+			},
+		})
+	}
+	return rc.Block, detail
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPConfig secures the dashboard (HTTP/WebSocket) and admin listeners
+type HTTPConfig struct {
+	// Browser origins allowed to open the WebSocket and call the HTTP API,
+	// e.g. "https://dashboard.example.com". "*" allows any origin. The
+	// server's own origin and non-browser clients are always allowed.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	TLSCert string `json:"tls_cert"` // PEM certificate; with tls_key, both listeners serve HTTPS
+	TLSKey  string `json:"tls_key"`
+
+	ContentSecurityPolicy string   `json:"content_security_policy"`
+	FrameOptions          string   `json:"frame_options"` // X-Frame-Options, empty omits it
+	HSTSMaxAge            Duration `json:"hsts_max_age"`  // Sent over TLS only, 0 omits it
+}
+
+// DefaultHTTPConfig returns settings that let the bundled dashboard connect
+// from the Next.js dev server
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		AllowedOrigins:        []string{"http://localhost:3000"},
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+		FrameOptions:          "DENY",
+		HSTSMaxAge:            Duration(365 * 24 * time.Hour),
+	}
+}
+
+// TLSEnabled reports whether the HTTP and admin listeners serve HTTPS
+func (c HTTPConfig) TLSEnabled() bool {
+	return c.TLSCert != ""
+}
+
+func (c HTTPConfig) validate() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("http tls_cert and tls_key must be set together")
+	}
+	if c.TLSEnabled() {
+		if _, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+			return fmt.Errorf("http tls: %w", err)
+		}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("http allowed_origins: %q must look like https://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// originAllowed reports whether a browser page on origin may talk to a
+// server reached as host. Requests without an Origin header don't come from
+// a browser and are allowed.
+func (c HTTPConfig) originAllowed(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin is the WebSocket upgrader's origin check
+func (s *Server) checkOrigin(r *http.Request) bool {
+	return s.config().HTTP.originAllowed(r.Header.Get("Origin"), r.Host)
+}
+
+// securityHeaders sets the configured response headers. Settings are read
+// per request, so reloads apply immediately.
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.config().HTTP
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		if cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+		if cfg.FrameOptions != "" {
+			h.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if r.TLS != nil && cfg.HSTSMaxAge > 0 {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.FormatInt(int64(time.Duration(cfg.HSTSMaxAge).Seconds()), 10))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cors answers preflight requests and marks responses readable by allowed
+// origins. Disallowed origins get 403.
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.config().HTTP.originAllowed(origin, r.Host) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
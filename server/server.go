@@ -0,0 +1,316 @@
+// Package server implements the intrusion detection pipeline: the gRPC
+// StreamLogs ingest, Redis-backed rate limiting, the dashboard WebSocket feed
+// and the authenticated admin API. Construct one with NewServer and either
+// call Run, or Start it and mount Register/HTTPHandler/AdminHandler and
+// RegisterManagement yourself.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shashank/intrusiondetection/core"
+	pb "github.com/shashank/intrusiondetection/proto"
+	"google.golang.org/grpc"
+)
+
+// Server is a complete intrusion detection pipeline bound to one Redis instance
+type Server struct {
+	pb.UnimplementedIntrusionDetectionServiceServer
+
+	cfg            atomic.Pointer[Config]     // Swapped by Reload
+	rules          atomic.Pointer[core.Rules] // Derived from cfg.Inspection
+	attackCfg      atomic.Pointer[Config]     // cfg with under-attack limits applied
+	attackRules    atomic.Pointer[core.Rules] // Derived from attackCfg.Inspection
+	monitor        atomic.Bool                // ModeMonitor is active
+	rdb            *redis.Client
+	stats          *Stats
+	hub            *WebSocketHub
+	localBlocklist *LocalBlocklist
+	blocklist      *Blocklist
+	talkers        *TalkerTracker
+	history        *RequestHistory
+	cardinality    *CardinalityMonitor
+	baseline       *BaselineLearner
+	attack         *AttackDetector
+	events         *EventRecorder
+	canary         *Canary
+	streams        *StreamRegistry
+	allowCache     *AllowCache
+	chaos          *Chaos
+	regions        *RegionSync    // nil unless regions are configured
+	geo            *GeoAggregator // nil unless a GeoIP database is configured
+	queue          *DiskQueue     // nil unless queue.dir is set
+	startTime      time.Time
+	instance       string        // Names the Redis keys this server's warm-up state is saved under
+	ready          chan struct{} // Closed when warm-up is done
+
+	ctx       context.Context // Set by Start; parent of restartable workers
+	feedsMu   sync.Mutex
+	stopFeeds context.CancelFunc
+}
+
+// NewServer validates cfg and connects to Redis
+func NewServer(cfg Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: cfg.RedisAddr,
+	})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+
+	chaos := &Chaos{}
+	rdb.AddHook(chaosHook{chaos: chaos})
+
+	s := &Server{
+		rdb:            rdb,
+		stats:          &Stats{},
+		hub:            NewWebSocketHub(),
+		localBlocklist: NewLocalBlocklist(),
+		blocklist:      NewBlocklist(rdb),
+		talkers:        NewTalkerTracker(),
+		history:        NewRequestHistory(cfg.HistorySize),
+		cardinality:    NewCardinalityMonitor(rdb),
+		baseline:       NewBaselineLearner(rdb),
+		attack:         NewAttackDetector(),
+		events:         NewEventRecorder(),
+		canary:         NewCanary(),
+		streams:        NewStreamRegistry(),
+		allowCache:     NewAllowCache(),
+		chaos:          chaos,
+		startTime:      time.Now(),
+		instance:       cfg.Warmup.instanceName(),
+		ready:          make(chan struct{}),
+	}
+	s.hub.chaos = chaos
+	s.setConfig(cfg)
+	if cfg.Regions.Enabled() {
+		s.blocklist.EnableJournal(cfg.Regions.Region)
+		s.regions = NewRegionSync(cfg.Regions)
+	}
+	if err := s.blocklist.Refresh(context.Background()); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+	if cfg.Geo.Database != "" {
+		db, err := OpenGeoDB(cfg.Geo.Database)
+		if err != nil {
+			rdb.Close()
+			return nil, fmt.Errorf("load GeoIP database: %w", err)
+		}
+		log.Printf("GeoIP database loaded: %d ranges", db.Len())
+		s.geo = NewGeoAggregator(rdb, db)
+	}
+	if cfg.Queue.Dir != "" {
+		q, err := OpenDiskQueue(cfg.Queue.Dir, cfg.Queue.MaxBytes, cfg.Queue.SegmentBytes)
+		if err != nil {
+			rdb.Close()
+			return nil, fmt.Errorf("open disk queue: %w", err)
+		}
+		if n := q.Len(); n > 0 {
+			log.Printf("Disk queue: %d records left by the previous process", n)
+		}
+		s.queue = q
+	}
+	publishExpvar(s)
+	return s, nil
+}
+
+// Register attaches the IntrusionDetectionService to a gRPC server
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	pb.RegisterIntrusionDetectionServiceServer(r, s)
+}
+
+// HTTPHandler serves the public WebSocket feed and, behind the admin token,
+// the alert history for the dashboard
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.wsHandler)
+	mux.Handle("/api/alerts", requireAdmin(s.config().AdminToken, http.HandlerFunc(s.alertsHandler)))
+	mux.HandleFunc("/readyz", s.readyHandler)
+	return s.securityHeaders(s.cors(mux))
+}
+
+// Start launches warm-up and the background workers (L1 cleanup, allow
+// cache, stats broadcaster, alert subscriber, cardinality monitor, baseline
+// learner, geo rollup, blocklist sync, region sync, top talkers, request
+// history, event log, disk queue drain). They stop when ctx is cancelled.
+// StreamLogs refuses streams until warm-up is done; see Ready and WaitReady.
+func (s *Server) Start(ctx context.Context) {
+	// Load bans and attack state saved by the previous process
+	go s.warmUp(ctx)
+
+	// Start L1 cache cleanup
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.localBlocklist.Cleanup()
+			}
+		}
+	}()
+
+	// Hand unused allow cache batches back to Redis
+	go s.startAllowCache(ctx)
+
+	// Start WebSocket stats broadcaster
+	go s.startStatsBroadcaster(ctx)
+
+	// Start alerts subscriber (forwards AI worker and server alerts to dashboard)
+	go s.startAlertSubscriber(ctx)
+
+	// Track unique source IPs per minute for distributed attack detection
+	go s.startCardinalityMonitor(ctx)
+
+	// Learn normal traffic for each hour of the day and alert on deviations
+	go s.startBaselineLearner(ctx)
+
+	// Roll up traffic by country and ASN for the dashboard
+	if s.geo != nil {
+		go s.startGeoRollup(ctx)
+	}
+
+	// Rotate the top talkers window and forget idle request history
+	go s.talkers.Run(ctx)
+	go s.history.Run(ctx)
+
+	// Persist processed requests for export and replay
+	go s.startEventRecorder(ctx)
+	go s.startRetentionPurge(ctx)
+	if s.queue != nil {
+		go s.startQueueDrain(ctx)
+	}
+
+	// Keep the managed blocklist in sync and re-import configured feeds
+	go s.startBlocklistRefresher(ctx)
+	if s.regions != nil {
+		go s.startRegionSync(ctx)
+	}
+	s.feedsMu.Lock()
+	s.ctx = ctx
+	s.feedsMu.Unlock()
+	s.restartFeeds()
+}
+
+// Run starts the workers and serves gRPC, HTTP and (when a token is
+// configured) the admin and management APIs until ctx is cancelled or a
+// listener fails. The canary only runs here, since it probes the server's
+// own gRPC listener.
+func (s *Server) Run(ctx context.Context) error {
+	s.Start(ctx)
+	cfg := s.config()
+
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", cfg.GRPCAddr, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	s.Register(grpcServer)
+	go s.startCanary(ctx, canaryTarget(lis.Addr()))
+
+	var mgmtServer *grpc.Server
+	var mgmtLis net.Listener
+	if cfg.ManagementAddr != "" && cfg.AdminToken != "" {
+		if mgmtLis, err = net.Listen("tcp", cfg.ManagementAddr); err != nil {
+			lis.Close()
+			return fmt.Errorf("listen on %s: %w", cfg.ManagementAddr, err)
+		}
+		mgmtServer = grpc.NewServer(grpc.UnaryInterceptor(s.ManagementAuth))
+		s.RegisterManagement(mgmtServer)
+	} else {
+		log.Printf("Management API disabled (no management address or admin token configured)")
+	}
+
+	httpServers := []*http.Server{{Addr: cfg.HTTPAddr, Handler: s.HTTPHandler()}}
+	if cfg.AdminAddr != "" && cfg.AdminToken != "" {
+		httpServers = append(httpServers, &http.Server{Addr: cfg.AdminAddr, Handler: s.AdminHandler()})
+	} else {
+		log.Printf("Admin server disabled (no admin address or token configured)")
+	}
+
+	errCh := make(chan error, len(httpServers)+2)
+	for _, hs := range httpServers {
+		hs := hs
+		go func() {
+			var err error
+			if httpCfg := cfg.HTTP; httpCfg.TLSEnabled() {
+				log.Printf("HTTPS server listening on %s", hs.Addr)
+				err = hs.ListenAndServeTLS(httpCfg.TLSCert, httpCfg.TLSKey)
+			} else {
+				log.Printf("HTTP server listening on %s", hs.Addr)
+				err = hs.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("HTTP server on %s: %w", hs.Addr, err)
+			}
+		}()
+	}
+
+	go func() {
+		log.Printf("gRPC server listening on %s", cfg.GRPCAddr)
+		log.Printf("Rate limit: %d requests per %v per IP", cfg.RateLimit, time.Duration(cfg.RateLimitWindow))
+		log.Printf("Mode: %s", s.Mode())
+		if err := grpcServer.Serve(lis); err != nil {
+			errCh <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+
+	if mgmtServer != nil {
+		go func() {
+			log.Printf("Management API listening on %s", cfg.ManagementAddr)
+			if err := mgmtServer.Serve(mgmtLis); err != nil {
+				errCh <- fmt.Errorf("management server: %w", err)
+			}
+		}()
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-errCh:
+	}
+
+	// Streams are long-lived, so don't wait for them to finish
+	grpcServer.Stop()
+	if mgmtServer != nil {
+		mgmtServer.Stop()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, hs := range httpServers {
+		hs.Shutdown(shutdownCtx)
+	}
+
+	return runErr
+}
+
+// Close disconnects dashboard clients and releases the Redis connection and
+// the disk queue
+func (s *Server) Close() error {
+	s.hub.Close()
+	if s.regions != nil {
+		s.regions.Close()
+	}
+	if s.queue != nil {
+		s.queue.Close()
+	}
+	return s.rdb.Close()
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// Stats tracks request metrics atomically
+type Stats struct {
+	requestsThisSecond atomic.Int64
+	blockedThisSecond  atomic.Int64
+	totalRequests      atomic.Int64
+	totalBlocked       atomic.Int64
+	activeStreams      atomic.Int64
+	lostWrites         atomic.Int64 // Events and alerts neither written to Redis nor queued
+
+	blockedByReason      [numReasons]atomic.Int64 // Per second, indexed by pb.Reason
+	totalBlockedByReason [numReasons]atomic.Int64
+}
+
+// recordBlock counts a blocked request under its reason
+func (st *Stats) recordBlock(reason pb.Reason) {
+	st.blockedThisSecond.Add(1)
+	st.totalBlocked.Add(1)
+	st.blockedByReason[reason].Add(1)
+	st.totalBlockedByReason[reason].Add(1)
+}
+
+// DashboardPayload is sent to WebSocket clients
+type DashboardPayload struct {
+	RPS         int64            `json:"rps"`
+	Blocked     int64            `json:"blocked"`
+	BlockedBy   map[string]int64 `json:"blocked_by,omitempty"` // Blocked split by reason label
+	Timestamp   int64            `json:"timestamp"`
+	UnderAttack bool             `json:"under_attack"`
+}
+
+// startStatsBroadcaster sends stats to all WebSocket clients every second
+func (s *Server) startStatsBroadcaster(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Get and reset per-second counters
+		rps := s.stats.requestsThisSecond.Swap(0)
+		blocked := s.stats.blockedThisSecond.Swap(0)
+		var blockedBy map[string]int64
+		for reason := range s.stats.blockedByReason {
+			if n := s.stats.blockedByReason[reason].Swap(0); n > 0 {
+				if blockedBy == nil {
+					blockedBy = make(map[string]int64)
+				}
+				blockedBy[reasonLabel(pb.Reason(reason))] = n
+			}
+		}
+
+		now := time.Now()
+		s.evaluateAttack(ctx, rps, blocked, now)
+
+		payload := DashboardPayload{
+			RPS:         rps,
+			Blocked:     blocked,
+			BlockedBy:   blockedBy,
+			Timestamp:   now.Unix(),
+			UnderAttack: s.attack.Active(),
+		}
+
+		s.hub.Broadcast(payload)
+	}
+}
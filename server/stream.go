@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/shashank/intrusiondetection/core"
+	pb "github.com/shashank/intrusiondetection/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) checkRateLimit(ctx context.Context, cfg *Config, ip string) bool {
+	if s.localBlocklist.IsBlocked(ip) {
+		return false
+	}
+
+	key := fmt.Sprintf("ratelimit:%s", ip)
+	if cfg.AllowCache.Enabled {
+		return s.checkRateLimitCached(ctx, cfg, ip, key)
+	}
+	allowed, err := core.Allow(ctx, s.rdb, key, time.Now(), time.Duration(cfg.RateLimitWindow), cfg.RateLimit)
+	if err != nil {
+		log.Printf("Redis error: %v (allowing request)", err)
+		return true
+	}
+
+	if !allowed {
+		s.ban(ip, time.Duration(cfg.LocalBlockTTL))
+		return false
+	}
+
+	return true
+}
+
+// checkRateLimitCached admits from the IP's local lease when it has one, and
+// otherwise reserves a batch from Redis if the IP is busy or a single
+// request if not
+func (s *Server) checkRateLimitCached(ctx context.Context, cfg *Config, ip, key string) bool {
+	now := time.Now()
+	hit, busy := s.allowCache.Take(ip, now)
+	if hit {
+		return true
+	}
+
+	n := 1
+	if busy {
+		n = cfg.AllowCache.Batch
+	}
+	s.allowCache.reserved.Add(1)
+	granted, err := core.Reserve(ctx, s.rdb, key, now, time.Duration(cfg.RateLimitWindow), cfg.RateLimit, n)
+	if err != nil {
+		log.Printf("Redis error: %v (allowing request)", err)
+		return true
+	}
+	if granted == 0 {
+		s.ban(ip, time.Duration(cfg.LocalBlockTTL))
+		return false
+	}
+
+	s.allowCache.Put(ip, key, now, granted-1, time.Duration(cfg.AllowCache.Slice))
+	return true
+}
+
+func (s *Server) publishToAIWorker(ip string, timestamp int64, payloadSize int) {
+	msg := fmt.Sprintf("%s|%d|%d", ip, timestamp, payloadSize)
+	go s.rdb.Publish(context.Background(), trafficMonitorCh, msg)
+}
+
+func (s *Server) StreamLogs(stream pb.IntrusionDetectionService_StreamLogsServer) error {
+	// Agents retry Unavailable, by which time bans are loaded
+	if !s.Ready() {
+		return status.Error(codes.Unavailable, "server is warming up")
+	}
+
+	ctx := stream.Context()
+	peerAddr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		peerAddr = p.Addr.String()
+	}
+	var userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			userAgent = ua[0]
+		}
+	}
+
+	entry := s.streams.Add(peerAddr, userAgent)
+	defer s.streams.Remove(entry.id)
+	log.Printf("Client %s connected to StreamLogs (stream %d)", peerAddr, entry.id)
+
+	s.stats.activeStreams.Add(1)
+	defer s.stats.activeStreams.Add(-1)
+
+	// Recv can't be interrupted, so the stream is served on its own goroutine
+	// and a forced disconnect ends the RPC underneath it
+	done := make(chan error, 1)
+	go func() { done <- s.serveStream(stream, entry) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-entry.kill:
+		log.Printf("Stream %d from %s disconnected by operator", entry.id, peerAddr)
+		return status.Error(codes.Aborted, "disconnected by operator")
+	}
+}
+
+// serveStream decides each request on stream until the client goes away
+func (s *Server) serveStream(stream pb.IntrusionDetectionService_StreamLogsServer, entry *streamEntry) error {
+	ctx := stream.Context()
+	// Canary probes are decided like any request but left out of traffic data
+	probe := s.canary.isProbe(ctx)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			log.Println("Client closed stream")
+			return nil
+		}
+		if err != nil {
+			log.Printf("Receive error: %v", err)
+			return err
+		}
+
+		cfg, rules := s.enforced()
+		ip := req.GetIpAddress()
+
+		var finding *Finding
+		if !core.VerifySignature(req.GetPayload(), req.GetTimestamp(), req.GetSignature(), cfg.SecretKey) {
+			finding = &Finding{Check: CheckSignature, Message: "Invalid HMAC signature"}
+		} else if v := rules.Inspect(ip, req.GetPayload(), req.GetTimestamp(), time.Now()); v != nil {
+			finding = &Finding{Check: CheckInspection, Rule: v.Rule, Message: v.Error()}
+		} else if match, ok := s.blocklist.Match(ip); ok {
+			finding = &Finding{Check: CheckBlocklist, Rule: match.Target, Message: match.describe(), RetryAfter: match.remaining(time.Now())}
+		} else if replayed, detail := s.checkReplay(ctx, cfg, ip, req.GetPayload(), req.GetSignature()); replayed {
+			finding = &Finding{Check: CheckReplay, Message: detail}
+		} else if !s.checkRateLimit(ctx, cfg, ip) {
+			finding = &Finding{
+				Check:      CheckRateLimit,
+				Message:    fmt.Sprintf("Rate limit exceeded: %d requests per %v", cfg.RateLimit, time.Duration(cfg.RateLimitWindow)),
+				RetryAfter: s.localBlocklist.Remaining(ip),
+			}
+		}
+
+		// The configured action decides what the agent is told
+		outcome := cfg.outcome(finding)
+		if outcome.Action == ActionAlert {
+			s.alertFinding(ctx, ip, finding)
+		}
+
+		if !probe {
+			s.recordDecision(cfg, entry, req, outcome)
+		}
+
+		// Monitor mode reports what would have happened but lets everything through
+		resp := outcome.response(s.monitor.Load())
+		if err := stream.Send(resp); err != nil {
+			log.Printf("Send error: %v", err)
+			return err
+		}
+
+		if !probe {
+			s.publishToAIWorker(ip, req.GetTimestamp(), len(req.GetPayload()))
+		}
+	}
+}
+
+// recordDecision adds a decided request to stats, top talkers, the
+// cardinality, baseline and geo counters, request history and the event log
+func (s *Server) recordDecision(cfg *Config, entry *streamEntry, req *pb.LogRequest, outcome Outcome) {
+	ip := req.GetIpAddress()
+	blocked := outcome.Blocked
+	now := time.Now()
+
+	s.stats.requestsThisSecond.Add(1)
+	s.stats.totalRequests.Add(1)
+	if blocked {
+		s.stats.recordBlock(outcome.Reason)
+	}
+	entry.record(ip, blocked, now)
+	s.talkers.Record(ip, blocked)
+	s.cardinality.Record(ip, now)
+	s.baseline.Record(len(req.GetPayload()), blocked, now)
+	if s.geo != nil {
+		s.geo.Record(ip, blocked, now)
+	}
+	s.history.Record(ip, outcome.Status, len(req.GetPayload()), now)
+	if cfg.Events.Enabled {
+		rule := outcome.Rule
+		if outcome.Reason == pb.Reason_REASON_BLOCKLIST && cfg.Privacy.enabled() {
+			rule = "" // The blocklist target names the IP or its range
+		}
+		event := Event{
+			IP:          cfg.Privacy.Anonymize(ip),
+			Timestamp:   req.GetTimestamp(),
+			ReceivedAt:  now.UnixMilli(),
+			PayloadSize: len(req.GetPayload()),
+			Status:      outcome.Status,
+			Reason:      reasonLabel(outcome.Reason),
+			Rule:        rule,
+		}
+		if cfg.Events.Payloads {
+			event.Payload = req.GetPayload()
+		}
+		s.events.Record(event)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamInfo describes one active StreamLogs stream
+type StreamInfo struct {
+	ID              uint64  `json:"id"`
+	Peer            string  `json:"peer"`
+	UserAgent       string  `json:"user_agent,omitempty"`
+	StartedAt       int64   `json:"started_at"` // Unix seconds
+	DurationSeconds float64 `json:"duration_seconds"`
+	Messages        int64   `json:"messages"`
+	Blocked         int64   `json:"blocked"`
+	MessagesPerSec  float64 `json:"messages_per_sec"`          // Averaged over the stream's life
+	LastMessageAt   int64   `json:"last_message_at,omitempty"` // Unix milliseconds
+	LastIP          string  `json:"last_ip,omitempty"`
+}
+
+// streamEntry is the live state of one stream. Counters are updated by the
+// stream's own goroutine and read by the API.
+type streamEntry struct {
+	id        uint64
+	peer      string
+	userAgent string
+	startedAt time.Time
+	kill      chan struct{} // Closed to force a disconnect
+	killOnce  sync.Once
+
+	messages    atomic.Int64
+	blocked     atomic.Int64
+	lastMessage atomic.Int64
+	lastIP      atomic.Pointer[string]
+}
+
+// record counts one message from ip
+func (e *streamEntry) record(ip string, blocked bool, now time.Time) {
+	e.messages.Add(1)
+	if blocked {
+		e.blocked.Add(1)
+	}
+	e.lastMessage.Store(now.UnixMilli())
+	if last := e.lastIP.Load(); last == nil || *last != ip {
+		e.lastIP.Store(&ip)
+	}
+}
+
+func (e *streamEntry) info(now time.Time) StreamInfo {
+	info := StreamInfo{
+		ID:              e.id,
+		Peer:            e.peer,
+		UserAgent:       e.userAgent,
+		StartedAt:       e.startedAt.Unix(),
+		DurationSeconds: now.Sub(e.startedAt).Seconds(),
+		Messages:        e.messages.Load(),
+		Blocked:         e.blocked.Load(),
+		LastMessageAt:   e.lastMessage.Load(),
+	}
+	if info.DurationSeconds > 0 {
+		info.MessagesPerSec = float64(info.Messages) / info.DurationSeconds
+	}
+	if ip := e.lastIP.Load(); ip != nil {
+		info.LastIP = *ip
+	}
+	return info
+}
+
+// StreamRegistry tracks the active StreamLogs streams
+type StreamRegistry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[uint64]*streamEntry
+}
+
+// NewStreamRegistry returns an empty registry
+func NewStreamRegistry() *StreamRegistry {
+	return &StreamRegistry{streams: make(map[uint64]*streamEntry)}
+}
+
+// Add registers a new stream
+func (r *StreamRegistry) Add(peer, userAgent string) *streamEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	e := &streamEntry{
+		id:        r.nextID,
+		peer:      peer,
+		userAgent: userAgent,
+		startedAt: time.Now(),
+		kill:      make(chan struct{}),
+	}
+	r.streams[e.id] = e
+	return e
+}
+
+// Remove forgets a stream once it has ended
+func (r *StreamRegistry) Remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams, id)
+}
+
+// List returns the active streams, oldest first
+func (r *StreamRegistry) List() []StreamInfo {
+	r.mu.Lock()
+	entries := make([]*streamEntry, 0, len(r.streams))
+	for _, e := range r.streams {
+		entries = append(entries, e)
+	}
+	r.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]StreamInfo, len(entries))
+	for i, e := range entries {
+		infos[i] = e.info(now)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Disconnect ends stream id. It reports false if no such stream is active.
+func (r *StreamRegistry) Disconnect(id uint64) bool {
+	r.mu.Lock()
+	e, ok := r.streams[id]
+	r.mu.Unlock()
+
+	if ok {
+		e.killOnce.Do(func() { close(e.kill) })
+	}
+	return ok
+}
+
+// streamsHandler serves GET /api/streams and DELETE /api/streams?id=
+func (s *Server) streamsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.streams.List())
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be a stream ID", http.StatusBadRequest)
+			return
+		}
+		if !s.streams.Disconnect(id) {
+			http.Error(w, fmt.Sprintf("stream %d is not active", id), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
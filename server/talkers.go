@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	talkerWindow     = time.Minute // Counts cover the current and previous window
+	maxTalkerEntries = 100_000     // New IPs are ignored once a window holds this many
+)
+
+// Talker is one source IP's request counts over the last one to two minutes
+type Talker struct {
+	IP       string `json:"ip"`
+	Requests int64  `json:"requests"`
+	Blocked  int64  `json:"blocked"`
+}
+
+type talkerCounts struct {
+	requests int64
+	blocked  int64
+}
+
+// TalkerTracker counts requests per source IP in rotating one-minute windows
+type TalkerTracker struct {
+	mu       sync.Mutex
+	current  map[string]*talkerCounts
+	previous map[string]*talkerCounts
+}
+
+// NewTalkerTracker returns an empty tracker
+func NewTalkerTracker() *TalkerTracker {
+	return &TalkerTracker{
+		current:  make(map[string]*talkerCounts),
+		previous: make(map[string]*talkerCounts),
+	}
+}
+
+// Record counts one request from ip
+func (t *TalkerTracker) Record(ip string, blocked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.current[ip]
+	if !ok {
+		if len(t.current) >= maxTalkerEntries {
+			return
+		}
+		c = &talkerCounts{}
+		t.current[ip] = c
+	}
+	c.requests++
+	if blocked {
+		c.blocked++
+	}
+}
+
+// Top returns the n IPs with the most requests
+func (t *TalkerTracker) Top(n int) []Talker {
+	t.mu.Lock()
+	merged := make(map[string]Talker, len(t.current))
+	for _, window := range []map[string]*talkerCounts{t.previous, t.current} {
+		for ip, c := range window {
+			talker := merged[ip]
+			talker.IP = ip
+			talker.Requests += c.requests
+			talker.Blocked += c.blocked
+			merged[ip] = talker
+		}
+	}
+	t.mu.Unlock()
+
+	talkers := make([]Talker, 0, len(merged))
+	for _, talker := range merged {
+		talkers = append(talkers, talker)
+	}
+	sort.Slice(talkers, func(i, j int) bool {
+		if talkers[i].Requests != talkers[j].Requests {
+			return talkers[i].Requests > talkers[j].Requests
+		}
+		return talkers[i].IP < talkers[j].IP
+	})
+	if len(talkers) > n {
+		talkers = talkers[:n]
+	}
+	return talkers
+}
+
+// restore puts saved talkers in the previous window, so they age out with it
+func (t *TalkerTracker) restore(talkers []Talker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, talker := range talkers {
+		t.previous[talker.IP] = &talkerCounts{requests: talker.Requests, blocked: talker.Blocked}
+	}
+}
+
+// Run rotates the windows until ctx is cancelled
+func (t *TalkerTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(talkerWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			t.previous = t.current
+			t.current = make(map[string]*talkerCounts, len(t.previous))
+			t.mu.Unlock()
+		}
+	}
+}
+
+// talkersHandler serves GET /api/talkers?limit=N
+func (s *Server) talkersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, s.talkers.Top(limit))
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	pb "github.com/shashank/intrusiondetection/proto"
+)
+
+// The state keys below are per server, suffixed with its instance name, so
+// servers sharing a Redis don't restore each other's state
+const (
+	bansKey               = "rate_limit_bans" // Sorted set of rate limit bans scored by expiry (Unix ms)
+	attackStateKey        = "attack_state"    // JSON snapshot of the attack detector
+	counterStateKey       = "counter_state"   // JSON snapshot of request totals and top talkers
+	policyStateKey        = "policy_state"    // Hash of the policy and mode set at runtime
+	stateSaveEvery        = 10 * time.Second
+	savedTalkers          = 1000 // Top talkers kept across a restart
+	warmupRetryBackoffMax = 2 * time.Second
+)
+
+// WarmupConfig controls loading state from Redis before traffic is accepted
+type WarmupConfig struct {
+	Timeout  Duration `json:"timeout"`   // Serve with whatever loaded after this long
+	StateTTL Duration `json:"state_ttl"` // Attack state and counters saved longer ago than this are ignored
+	Instance string   `json:"instance"`  // Names this server's saved state; defaults to the host name
+}
+
+// DefaultWarmupConfig returns the warm-up settings used out of the box
+func DefaultWarmupConfig() WarmupConfig {
+	return WarmupConfig{
+		Timeout:  Duration(10 * time.Second),
+		StateTTL: Duration(time.Hour),
+	}
+}
+
+func (c WarmupConfig) validate() error {
+	if c.Timeout <= 0 || c.StateTTL <= 0 {
+		return errors.New("warmup timeout and state_ttl must be positive")
+	}
+	return nil
+}
+
+// instanceName returns the name this server's state is saved under
+func (c WarmupConfig) instanceName() string {
+	if c.Instance != "" {
+		return c.Instance
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "default"
+}
+
+// stateKey returns the Redis key for this server's copy of the state at prefix
+func (s *Server) stateKey(prefix string) string {
+	return prefix + ":" + s.instance
+}
+
+// attackState is the part of the attack detector that survives a restart
+type attackState struct {
+	Override string  `json:"override"`
+	Auto     bool    `json:"auto"`
+	Since    int64   `json:"since,omitempty"` // Unix seconds
+	Baseline float64 `json:"baseline"`
+	Learned  int     `json:"learned"`
+	SavedAt  int64   `json:"saved_at"` // Unix seconds
+}
+
+// snapshot returns the state worth keeping across a restart
+func (d *AttackDetector) snapshot(now time.Time) attackState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := attackState{Override: d.override, Auto: d.auto, Baseline: d.baseline, Learned: d.learned, SavedAt: now.Unix()}
+	if !d.since.IsZero() {
+		st.Since = d.since.Unix()
+	}
+	return st
+}
+
+// restore picks up where a previous process left off. The effective state
+// is published without an alert, since it was announced when it changed.
+func (d *AttackDetector) restore(st attackState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if st.Override != "" {
+		d.override = st.Override
+	}
+	d.auto = st.Auto
+	d.baseline, d.learned = st.Baseline, st.Learned
+	d.last.BaselineRPS = st.Baseline
+	d.apply(time.Now())
+	if st.Since != 0 {
+		d.since = time.Unix(st.Since, 0)
+	}
+}
+
+// counterState is the request totals and top talkers that survive a restart
+type counterState struct {
+	Requests  int64            `json:"requests"`
+	Blocked   int64            `json:"blocked"`
+	BlockedBy map[string]int64 `json:"blocked_by,omitempty"` // Keyed by reason label
+	Talkers   []Talker         `json:"talkers,omitempty"`
+	SavedAt   int64            `json:"saved_at"` // Unix seconds
+}
+
+// counterSnapshot returns the counters worth keeping across a restart
+func (s *Server) counterSnapshot(now time.Time) counterState {
+	st := counterState{
+		Requests:  s.stats.totalRequests.Load(),
+		Blocked:   s.stats.totalBlocked.Load(),
+		BlockedBy: make(map[string]int64),
+		Talkers:   s.talkers.Top(savedTalkers),
+		SavedAt:   now.Unix(),
+	}
+	for reason := 1; reason < numReasons; reason++ {
+		if n := s.stats.totalBlockedByReason[reason].Load(); n > 0 {
+			st.BlockedBy[reasonLabel(pb.Reason(reason))] = n
+		}
+	}
+	return st
+}
+
+// restoreCounters adds saved totals to the counters. Top talkers are only
+// restored while they still describe the last couple of minutes.
+func (s *Server) restoreCounters(st counterState, now time.Time) {
+	s.stats.totalRequests.Add(st.Requests)
+	s.stats.totalBlocked.Add(st.Blocked)
+	for reason := 1; reason < numReasons; reason++ {
+		s.stats.totalBlockedByReason[reason].Add(st.BlockedBy[reasonLabel(pb.Reason(reason))])
+	}
+	if now.Sub(time.Unix(st.SavedAt, 0)) < talkerWindow {
+		s.talkers.restore(st.Talkers)
+	}
+}
+
+// savePolicyState records a policy or mode set at runtime so a restart
+// keeps it. Nothing is saved before warm-up, which would restore over it.
+func (s *Server) savePolicyState(field string, value any) {
+	if !s.Ready() {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.rdb.HSet(ctx, s.stateKey(policyStateKey), field, data).Err(); err != nil {
+		log.Printf("Saving runtime %s failed, it won't survive a restart: %v", field, err)
+	}
+}
+
+// clearPolicyState forgets the policy and mode set at runtime
+func (s *Server) clearPolicyState() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.rdb.Del(ctx, s.stateKey(policyStateKey)).Err(); err != nil {
+		log.Printf("Clearing the runtime policy failed, a restart would restore it: %v", err)
+	}
+}
+
+// ban puts ip in the L1 blocklist and records it in Redis so a restarted
+// server still enforces it
+func (s *Server) ban(ip string, ttl time.Duration) {
+	s.localBlocklist.Block(ip, ttl)
+	expires := time.Now().Add(ttl).UnixMilli()
+	go s.rdb.ZAdd(context.Background(), bansKey, redis.Z{Score: float64(expires), Member: ip})
+}
+
+// Ready reports whether warm-up has finished and requests are accepted
+func (s *Server) Ready() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitReady blocks until warm-up has finished or ctx is cancelled
+func (s *Server) WaitReady(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// warmUp loads the policy and mode set at runtime, active bans, the attack
+// detector's state, request counters and the learned traffic baselines from
+// Redis, then opens the readiness gate and starts saving state for the next
+// restart. Redis errors are retried until the
+// warm-up timeout, after which the server serves with whatever it has, as it
+// does when Redis fails mid-request.
+func (s *Server) warmUp(ctx context.Context) {
+	cfg := s.config().Warmup
+	start := time.Now()
+	deadline, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	defer cancel()
+
+	var bans int
+	var policy, restored, counters, baselines bool
+	if err := retryWarmup(deadline, func() (err error) {
+		policy, err = s.loadPolicyState(deadline)
+		return err
+	}); err != nil {
+		log.Printf("Warm-up: runtime policy not loaded: %v", err)
+	}
+	if err := retryWarmup(deadline, func() (err error) {
+		bans, err = s.loadBans(deadline)
+		return err
+	}); err != nil {
+		log.Printf("Warm-up: bans not loaded: %v", err)
+	}
+	if err := retryWarmup(deadline, func() (err error) {
+		restored, err = s.loadAttackState(deadline, time.Duration(cfg.StateTTL))
+		return err
+	}); err != nil {
+		log.Printf("Warm-up: attack state not loaded: %v", err)
+	}
+	if err := retryWarmup(deadline, func() (err error) {
+		counters, err = s.loadCounters(deadline, time.Duration(cfg.StateTTL))
+		return err
+	}); err != nil {
+		log.Printf("Warm-up: counters not loaded: %v", err)
+	}
+	if err := retryWarmup(deadline, func() (err error) {
+		baselines, err = s.loadBaselines(deadline)
+		return err
+	}); err != nil {
+		log.Printf("Warm-up: baselines not loaded: %v", err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	log.Printf("Warm-up done in %v: %d bans loaded, runtime policy restored: %v, attack state restored: %v, counters restored: %v, baselines restored: %v",
+		time.Since(start).Round(time.Millisecond), bans, policy, restored, counters, baselines)
+	close(s.ready)
+	s.saveWarmupState(ctx)
+}
+
+// retryWarmup calls load until it succeeds or ctx is done
+func retryWarmup(ctx context.Context, load func() error) error {
+	backoff := 100 * time.Millisecond
+	for {
+		err := load()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, warmupRetryBackoffMax)
+	}
+}
+
+// loadBans copies unexpired rate limit bans into the L1 blocklist
+func (s *Server) loadBans(ctx context.Context) (int, error) {
+	now := time.Now()
+	bans, err := s.rdb.ZRangeByScoreWithScores(ctx, bansKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", bansKey, err)
+	}
+	for _, b := range bans {
+		ip, _ := b.Member.(string)
+		s.localBlocklist.Block(ip, time.UnixMilli(int64(b.Score)).Sub(now))
+	}
+	return len(bans), nil
+}
+
+// loadPolicyState applies the policy and mode set at runtime before the
+// restart, and reports whether there were any
+func (s *Server) loadPolicyState(ctx context.Context) (bool, error) {
+	key := s.stateKey(policyStateKey)
+	saved, err := s.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", key, err)
+	}
+	if data, ok := saved["policy"]; ok {
+		var p Policy
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			log.Printf("Warm-up: ignoring unreadable runtime policy: %v", err)
+		} else if _, err := s.SetPolicy(p); err != nil {
+			log.Printf("Warm-up: ignoring runtime policy: %v", err)
+		}
+	}
+	if data, ok := saved["mode"]; ok {
+		var mode string
+		if err := json.Unmarshal([]byte(data), &mode); err != nil || s.SetMode(mode) != nil {
+			log.Printf("Warm-up: ignoring runtime mode %s", data)
+		}
+	}
+	return len(saved) > 0, nil
+}
+
+// loadAttackState restores the attack detector unless the saved state is
+// missing or older than ttl, and reports whether it did
+func (s *Server) loadAttackState(ctx context.Context, ttl time.Duration) (bool, error) {
+	key := s.stateKey(attackStateKey)
+	data, err := s.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", key, err)
+	}
+	var st attackState
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("Warm-up: ignoring unreadable attack state: %v", err)
+		return false, nil
+	}
+	if time.Since(time.Unix(st.SavedAt, 0)) > ttl {
+		return false, nil
+	}
+	s.attack.restore(st)
+	return true, nil
+}
+
+// loadCounters restores request totals and top talkers unless the saved
+// state is missing or older than ttl, and reports whether it did
+func (s *Server) loadCounters(ctx context.Context, ttl time.Duration) (bool, error) {
+	key := s.stateKey(counterStateKey)
+	data, err := s.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", key, err)
+	}
+	var st counterState
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("Warm-up: ignoring unreadable counters: %v", err)
+		return false, nil
+	}
+	now := time.Now()
+	if now.Sub(time.Unix(st.SavedAt, 0)) > ttl {
+		return false, nil
+	}
+	s.restoreCounters(st, now)
+	return true, nil
+}
+
+// saveWarmupState saves state for the next restart every few seconds until
+// ctx is cancelled
+func (s *Server) saveWarmupState(ctx context.Context) {
+	ticker := time.NewTicker(stateSaveEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.saveState(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("Warm-up state save error: %v", err)
+			}
+		}
+	}
+}
+
+// saveState writes the attack detector's state and the counters, and drops
+// expired bans
+func (s *Server) saveState(ctx context.Context, now time.Time) error {
+	attack, err := json.Marshal(s.attack.snapshot(now))
+	if err != nil {
+		return err
+	}
+	counters, err := json.Marshal(s.counterSnapshot(now))
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(s.config().Warmup.StateTTL)
+	pipe := s.rdb.Pipeline()
+	pipe.Set(ctx, s.stateKey(attackStateKey), attack, ttl)
+	pipe.Set(ctx, s.stateKey(counterStateKey), counters, ttl)
+	pipe.ZRemRangeByScore(ctx, bansKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// readyHandler serves GET /readyz: 200 once warm-up is done, 503 before
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}